@@ -19,6 +19,8 @@ package gce
 import (
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 
@@ -37,6 +39,69 @@ type machinesCacheValue struct {
 	err         error
 }
 
+// Default capacity and TTL settings for the GCE API result caches. Machine
+// types rarely change, so they can be cached for a long time; target sizes
+// are mutated by the autoscaler's own scaling decisions and by other actors,
+// so they need to be refreshed much more often.
+const (
+	defaultCacheEntryLimit = 5000
+
+	defaultMachineTypeCacheTTL          = 1 * time.Hour
+	defaultMigTargetSizeCacheTTL        = 30 * time.Second
+	defaultMigBasenameCacheTTL          = 10 * time.Minute
+	defaultInstanceTemplateNameCacheTTL = 10 * time.Minute
+	defaultInstanceTemplateCacheTTL     = 10 * time.Minute
+	defaultAutoscalingOptionsCacheTTL   = 10 * time.Minute
+)
+
+// GceCacheConfig holds the per-resource TTL and LRU capacity settings used by
+// GceCache. Resources that are cheap to miss and expensive to leave stale
+// (target sizes) should use a short TTL; resources that barely change
+// (machine types) can use a long one.
+type GceCacheConfig struct {
+	// CacheEntryLimit is an approximate maximum number of entries kept per
+	// resource type before the least recently used entry is evicted.
+	// Applies independently to each of the caches below. Each cache is
+	// internally sharded (see sharding.go) and this limit is divided evenly
+	// across its shards, so it isn't a hard global cap: under uneven key
+	// hashing, a shard that gets more than its even share of keys starts
+	// evicting once it fills up even though the resource's total entry
+	// count is still below CacheEntryLimit.
+	CacheEntryLimit int
+	// ShardCount is the number of independently locked shards each
+	// resource map/cache is split into. Defaults to defaultShardCount if
+	// not positive. Higher values reduce lock contention in clusters
+	// with many MIGs at the cost of a little bookkeeping overhead.
+	ShardCount int
+
+	MachineTypeCacheTTL          time.Duration
+	MigTargetSizeCacheTTL        time.Duration
+	MigBasenameCacheTTL          time.Duration
+	InstanceTemplateNameCacheTTL time.Duration
+	InstanceTemplateCacheTTL     time.Duration
+	AutoscalingOptionsCacheTTL   time.Duration
+
+	// Store is used to persist and restore Snapshots for cold-start
+	// acceleration, see store.go. Defaults to a no-op store that doesn't
+	// persist anything.
+	Store CacheStore
+}
+
+// DefaultGceCacheConfig returns a GceCacheConfig with sane defaults for a
+// production cluster-autoscaler deployment.
+func DefaultGceCacheConfig() GceCacheConfig {
+	return GceCacheConfig{
+		CacheEntryLimit:              defaultCacheEntryLimit,
+		ShardCount:                   defaultShardCount,
+		MachineTypeCacheTTL:          defaultMachineTypeCacheTTL,
+		MigTargetSizeCacheTTL:        defaultMigTargetSizeCacheTTL,
+		MigBasenameCacheTTL:          defaultMigBasenameCacheTTL,
+		InstanceTemplateNameCacheTTL: defaultInstanceTemplateNameCacheTTL,
+		InstanceTemplateCacheTTL:     defaultInstanceTemplateCacheTTL,
+		AutoscalingOptionsCacheTTL:   defaultAutoscalingOptionsCacheTTL,
+	}
+}
+
 // GceCache is used for caching cluster resources state.
 //
 // It is needed to:
@@ -47,103 +112,186 @@ type machinesCacheValue struct {
 // - limit repetitive GCE API calls.
 //
 // Cache keeps these values and gives access to getters, setters and
-// invalidators all guarded with mutex. Cache does not refresh the data by
-// itself - it just provides an interface enabling access to this data.
+// invalidators. Cache does not refresh the data by itself - it just provides
+// an interface enabling access to this data.
+//
+// Every resource map/cache below is internally sharded (see sharding.go):
+// each shard has its own lock, so operations on keys that land in different
+// shards never contend with one another. Only resourceLimiter, a single
+// shared value rather than something keyed, is still guarded by a plain
+// mutex. The maps that mirror GCE API responses (machine types, target
+// sizes, basenames, instance template names/bodies, autoscaling options) are
+// additionally backed by a TTL+LRU cache so they can't grow without bound
+// and don't serve arbitrarily stale data; the maps that track live MIG
+// registration (migs, instancesToMig, instancesFromUnknownMig) are
+// explicitly managed via Register/Unregister/Set calls and are not subject
+// to TTL expiry.
+//
+// Every mutating call also notifies handlers registered via AddEventHandler,
+// see events.go, so other subsystems can react to cache changes instead of
+// polling it.
+//
+// Regional MIGs (migs that span every zone in a region, rather than a single
+// zone) are tracked in a parallel set of maps, see cache_regional.go; GetMig,
+// GetMigs and GetMigForInstance transparently include them.
 type GceCache struct {
-	cacheMutex sync.Mutex
-
 	// Cache content.
-	migs                      map[GceRef]Mig
-	instancesToMig            map[GceRef]GceRef
-	instancesFromUnknownMig   map[GceRef]bool
-	resourceLimiter           *cloudprovider.ResourceLimiter
-	autoscalingOptionsCache   map[GceRef]map[string]string
-	machinesCache             map[MachineTypeKey]machinesCacheValue
-	migTargetSizeCache        map[GceRef]int64
-	migBaseNameCache          map[GceRef]string
-	instanceTemplateNameCache map[GceRef]string
-	instanceTemplatesCache    map[GceRef]*gce.InstanceTemplate
-}
-
-// NewGceCache creates empty GceCache.
+	migs                    *shardedMap[GceRef, Mig]
+	instancesToMig          *shardedMap[GceRef, GceRef]
+	instancesFromUnknownMig *shardedMap[GceRef, bool]
+	// migToInstances is the reverse of instancesToMig: migRef -> the
+	// instance refs currently mapped to it. SetMigInstances/UnregisterMig
+	// replace a single MIG's instances on every refresh cycle, and looking
+	// them up here means that only touches migRef's own keys instead of
+	// scanning every shard of instancesToMig for matches.
+	migToInstances *shardedMap[GceRef, []GceRef]
+
+	resourceLimiterMutex sync.RWMutex
+	resourceLimiter      *cloudprovider.ResourceLimiter
+
+	autoscalingOptionsCache   *shardedTTLLruCache[GceRef, map[string]string]
+	machinesCache             *shardedTTLLruCache[MachineTypeKey, machinesCacheValue]
+	migTargetSizeCache        *shardedTTLLruCache[GceRef, int64]
+	migBaseNameCache          *shardedTTLLruCache[GceRef, string]
+	instanceTemplateNameCache *shardedTTLLruCache[GceRef, string]
+	instanceTemplatesCache    *shardedTTLLruCache[GceRef, *gce.InstanceTemplate]
+
+	// Regional MIG support, see cache_regional.go.
+	regionalMigs                *shardedMap[GceRef, Mig]
+	instancesToRegionalMig      *shardedMap[GceRef, GceRef]
+	regionalMigToInstances      *shardedMap[GceRef, []GceRef]
+	regionalMigTargetSizeCache  *shardedTTLLruCache[GceRef, int64]
+	regionalMigZoneDistribution *shardedMap[GceRef, map[string]int64]
+
+	// Event subscriptions, see events.go.
+	eventMutex       sync.RWMutex
+	eventSubscribers map[int64]*eventSubscriber
+	nextSubscriberID int64
+
+	// store persists and restores Snapshots for cold-start acceleration,
+	// see store.go.
+	store CacheStore
+
+	// generation is a counter bumped once per RefreshMigs pass, see
+	// generation.go and refresher.go.
+	generation atomic.Int64
+}
+
+// NewGceCache creates an empty GceCache using DefaultGceCacheConfig.
 func NewGceCache() *GceCache {
+	return NewGceCacheWithConfig(DefaultGceCacheConfig())
+}
+
+// NewGceCacheWithConfig creates an empty GceCache using the given config for
+// the shard count and the TTL/LRU capacity of the GCE API result caches.
+func NewGceCacheWithConfig(cfg GceCacheConfig) *GceCache {
+	limit := cfg.CacheEntryLimit
+	if limit <= 0 {
+		limit = defaultCacheEntryLimit
+	}
+	shardCount := cfg.ShardCount
+	if shardCount <= 0 {
+		shardCount = defaultShardCount
+	}
+	store := cfg.Store
+	if store == nil {
+		store = noopCacheStore{}
+	}
+
 	return &GceCache{
-		migs:                      map[GceRef]Mig{},
-		instancesToMig:            map[GceRef]GceRef{},
-		instancesFromUnknownMig:   map[GceRef]bool{},
-		autoscalingOptionsCache:   map[GceRef]map[string]string{},
-		machinesCache:             map[MachineTypeKey]machinesCacheValue{},
-		migTargetSizeCache:        map[GceRef]int64{},
-		migBaseNameCache:          map[GceRef]string{},
-		instanceTemplateNameCache: map[GceRef]string{},
-		instanceTemplatesCache:    map[GceRef]*gce.InstanceTemplate{},
+		migs:                    newShardedMap[GceRef, Mig](shardCount),
+		instancesToMig:          newShardedMap[GceRef, GceRef](shardCount),
+		instancesFromUnknownMig: newShardedMap[GceRef, bool](shardCount),
+		migToInstances:          newShardedMap[GceRef, []GceRef](shardCount),
+
+		autoscalingOptionsCache:   newShardedTTLLruCache[GceRef, map[string]string]("autoscalingOptions", shardCount, limit, cfg.AutoscalingOptionsCacheTTL),
+		machinesCache:             newShardedTTLLruCache[MachineTypeKey, machinesCacheValue]("machines", shardCount, limit, cfg.MachineTypeCacheTTL),
+		migTargetSizeCache:        newShardedTTLLruCache[GceRef, int64]("migTargetSize", shardCount, limit, cfg.MigTargetSizeCacheTTL),
+		migBaseNameCache:          newShardedTTLLruCache[GceRef, string]("migBasename", shardCount, limit, cfg.MigBasenameCacheTTL),
+		instanceTemplateNameCache: newShardedTTLLruCache[GceRef, string]("instanceTemplateName", shardCount, limit, cfg.InstanceTemplateNameCacheTTL),
+		instanceTemplatesCache:    newShardedTTLLruCache[GceRef, *gce.InstanceTemplate]("instanceTemplate", shardCount, limit, cfg.InstanceTemplateCacheTTL),
+
+		regionalMigs:                newShardedMap[GceRef, Mig](shardCount),
+		instancesToRegionalMig:      newShardedMap[GceRef, GceRef](shardCount),
+		regionalMigToInstances:      newShardedMap[GceRef, []GceRef](shardCount),
+		regionalMigTargetSizeCache:  newShardedTTLLruCache[GceRef, int64]("regionalMigTargetSize", shardCount, limit, cfg.MigTargetSizeCacheTTL),
+		regionalMigZoneDistribution: newShardedMap[GceRef, map[string]int64](shardCount),
+
+		eventSubscribers: map[int64]*eventSubscriber{},
+
+		store: store,
 	}
 }
 
 // RegisterMig returns true if the node group wasn't in cache before, or its config was updated.
 func (gc *GceCache) RegisterMig(newMig Mig) bool {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	oldMig, found := gc.migs[newMig.GceRef()]
-	if found {
-		if !reflect.DeepEqual(oldMig, newMig) {
-			gc.migs[newMig.GceRef()] = newMig
+	changed := gc.migs.Update(newMig.GceRef(), func(old Mig, found bool) (Mig, bool) {
+		if !found {
+			klog.V(1).Infof("Registering %s", newMig.GceRef().String())
+			return newMig, true
+		}
+		if !reflect.DeepEqual(old, newMig) {
 			klog.V(4).Infof("Updated Mig %s", newMig.GceRef().String())
-			return true
+			return newMig, true
 		}
-		return false
+		return old, false
+	})
+	if changed {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigRegistered(newMig) })
 	}
-
-	klog.V(1).Infof("Registering %s", newMig.GceRef().String())
-	gc.migs[newMig.GceRef()] = newMig
-	return true
+	return changed
 }
 
 // UnregisterMig returns true if the node group has been removed, and false if it was already missing from cache.
 func (gc *GceCache) UnregisterMig(toBeRemoved Mig) bool {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	if !gc.migs.DeleteIfPresent(toBeRemoved.GceRef()) {
+		return false
+	}
+	klog.V(1).Infof("Unregistered Mig %s", toBeRemoved.GceRef().String())
+	removed := gc.removeMigInstances(toBeRemoved.GceRef())
 
-	_, found := gc.migs[toBeRemoved.GceRef()]
-	if found {
-		klog.V(1).Infof("Unregistered Mig %s", toBeRemoved.GceRef().String())
-		delete(gc.migs, toBeRemoved.GceRef())
-		gc.removeMigInstances(toBeRemoved.GceRef())
-		return true
+	gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigUnregistered(toBeRemoved) })
+	if len(removed) > 0 {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(toBeRemoved.GceRef(), nil, removed) })
 	}
-	return false
+	return true
 }
 
-// GetMig returns a MIG for a given GceRef.
+// GetMig returns a MIG for a given GceRef, whether it is zonal or regional.
 func (gc *GceCache) GetMig(migRef GceRef) (Mig, bool) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	mig, found := gc.migs[migRef]
-	return mig, found
+	if mig, found := gc.migs.Get(migRef); found {
+		return mig, true
+	}
+	return gc.regionalMigs.Get(migRef)
 }
 
-// GetMigs returns a copy of migs list.
+// GetMigs returns a copy of the list of zonal and regional migs. Shards are
+// gathered in parallel.
 func (gc *GceCache) GetMigs() []Mig {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	zonal := gc.migs.Items()
+	regional := gc.regionalMigs.Items()
 
-	migs := make([]Mig, 0, len(gc.migs))
-	for _, mig := range gc.migs {
+	migs := make([]Mig, 0, len(zonal)+len(regional))
+	for _, mig := range zonal {
+		migs = append(migs, mig)
+	}
+	for _, mig := range regional {
 		migs = append(migs, mig)
 	}
 	return migs
 }
 
-// GetMigForInstance returns the cached MIG for instance GceRef
+// GetMigForInstance returns the cached MIG for instance GceRef. If the
+// instance belongs to a regional MIG, the regional MIG's GceRef is returned
+// rather than the GceRef of the zonal group it's physically running in.
 func (gc *GceCache) GetMigForInstance(instanceRef GceRef) (GceRef, bool) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	migRef, found := gc.instancesToMig[instanceRef]
-	if found {
+	if migRef, found := gc.instancesToMig.Get(instanceRef); found {
 		klog.V(5).Infof("MIG cache hit for %s", instanceRef)
+		return migRef, true
+	}
+	migRef, found := gc.instancesToRegionalMig.Get(instanceRef)
+	if found {
+		klog.V(5).Infof("Regional MIG cache hit for %s", instanceRef)
 	}
 	return migRef, found
 }
@@ -151,29 +299,43 @@ func (gc *GceCache) GetMigForInstance(instanceRef GceRef) (GceRef, bool) {
 // IsMigUnknownForInstance checks if MIG was marked as unknown for instance, meaning that
 // a Mig to which this instance should belong does not list it as one of its instances.
 func (gc *GceCache) IsMigUnknownForInstance(instanceRef GceRef) bool {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	unknown, _ := gc.instancesFromUnknownMig[instanceRef]
+	unknown, _ := gc.instancesFromUnknownMig.Get(instanceRef)
 	if unknown {
 		klog.V(5).Infof("Unknown MIG cache hit for %s", instanceRef)
 	}
 	return unknown
 }
 
-// SetMigInstances sets instances for a given Mig ref
+// SetMigInstances sets instances for a given Mig ref. For a regional MIG
+// ref, instances may span multiple zones; the per-zone instance counts are
+// then available via GetRegionalMigDistribution.
 func (gc *GceCache) SetMigInstances(migRef GceRef, instances []cloudprovider.Instance) error {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	if _, isRegional := gc.regionalMigs.Get(migRef); isRegional {
+		added, removed, err := gc.setRegionalMigInstances(migRef, instances)
+		if err != nil {
+			return err
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(migRef, added, removed) })
+		}
+		return nil
+	}
 
-	gc.removeMigInstances(migRef)
+	removed := gc.removeMigInstances(migRef)
+	added := make([]GceRef, 0, len(instances))
 	for _, instance := range instances {
 		instanceRef, err := GceRefFromProviderId(instance.Id)
 		if err != nil {
 			return err
 		}
-		delete(gc.instancesFromUnknownMig, instanceRef)
-		gc.instancesToMig[instanceRef] = migRef
+		gc.instancesFromUnknownMig.Delete(instanceRef)
+		gc.instancesToMig.Set(instanceRef, migRef)
+		added = append(added, instanceRef)
+	}
+	gc.migToInstances.Set(migRef, added)
+
+	if len(added) > 0 || len(removed) > 0 {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(migRef, added, removed) })
 	}
 	return nil
 }
@@ -181,116 +343,149 @@ func (gc *GceCache) SetMigInstances(migRef GceRef, instances []cloudprovider.Ins
 // MarkInstanceMigUnknown sets instance MIG to unknown, meaning that a Mig to which
 // this instance should belong does not list it as one of its instances.
 func (gc *GceCache) MarkInstanceMigUnknown(instanceRef GceRef) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	gc.instancesFromUnknownMig[instanceRef] = true
+	gc.instancesFromUnknownMig.Set(instanceRef, true)
 }
 
 // InvalidateInstancesToMig clears the instance to mig mapping for a GceRef
 func (gc *GceCache) InvalidateInstancesToMig(migRef GceRef) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
 	klog.V(5).Infof("Mig instances cache invalidated for %s", migRef)
-	gc.removeMigInstances(migRef)
+	removed := gc.removeMigInstances(migRef)
+
+	if len(removed) > 0 {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(migRef, nil, removed) })
+	}
 }
 
-// InvalidateAllInstancesToMig clears the instance to mig cache
+// InvalidateAllInstancesToMig clears the instance to mig cache, for both
+// zonal and regional migs. Shards are cleared in parallel.
 func (gc *GceCache) InvalidateAllInstancesToMig() {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
 	klog.V(5).Infof("Instances to migs cache invalidated")
-	gc.instancesToMig = make(map[GceRef]GceRef)
-	gc.instancesFromUnknownMig = make(map[GceRef]bool)
+
+	removedByMig := make(map[GceRef][]GceRef)
+	for instanceRef, migRef := range gc.instancesToMig.Items() {
+		removedByMig[migRef] = append(removedByMig[migRef], instanceRef)
+	}
+	for instanceRef, migRef := range gc.instancesToRegionalMig.Items() {
+		removedByMig[migRef] = append(removedByMig[migRef], instanceRef)
+	}
+	gc.instancesToMig.Clear()
+	gc.migToInstances.Clear()
+	gc.instancesToRegionalMig.Clear()
+	gc.regionalMigToInstances.Clear()
+	gc.regionalMigZoneDistribution.Clear()
+	gc.instancesFromUnknownMig.Clear()
+
+	for migRef, removed := range removedByMig {
+		migRef, removed := migRef, removed
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(migRef, nil, removed) })
+	}
 }
 
-func (gc *GceCache) removeMigInstances(migRef GceRef) {
-	for instanceRef, instanceMigRef := range gc.instancesToMig {
-		if migRef == instanceMigRef {
-			delete(gc.instancesToMig, instanceRef)
-			delete(gc.instancesFromUnknownMig, instanceRef)
-		}
+// removeMigInstances removes every instance mapped to migRef from the
+// instance caches and returns the refs that were removed. Looking the
+// instances up through migToInstances, rather than scanning instancesToMig
+// for matches, means this only ever touches the shards holding migRef's own
+// instances, not every shard of instancesToMig.
+func (gc *GceCache) removeMigInstances(migRef GceRef) []GceRef {
+	removed, _ := gc.migToInstances.Get(migRef)
+	gc.migToInstances.Delete(migRef)
+	for _, instanceRef := range removed {
+		gc.instancesToMig.Delete(instanceRef)
+		gc.instancesFromUnknownMig.Delete(instanceRef)
 	}
+	return removed
 }
 
 // SetAutoscalingOptions stores autoscaling options strings obtained from IT.
 func (gc *GceCache) SetAutoscalingOptions(ref GceRef, options map[string]string) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-	gc.autoscalingOptionsCache[ref] = options
+	gc.autoscalingOptionsCache.Add(ref, options)
 }
 
 // GetAutoscalingOptions return autoscaling options strings obtained from IT.
 func (gc *GceCache) GetAutoscalingOptions(ref GceRef) map[string]string {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-	return gc.autoscalingOptionsCache[ref]
+	options, _ := gc.autoscalingOptionsCache.Get(ref)
+	return options
 }
 
 // SetResourceLimiter sets resource limiter.
 func (gc *GceCache) SetResourceLimiter(resourceLimiter *cloudprovider.ResourceLimiter) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	gc.resourceLimiterMutex.Lock()
+	defer gc.resourceLimiterMutex.Unlock()
 
 	gc.resourceLimiter = resourceLimiter
 }
 
 // GetResourceLimiter returns resource limiter.
 func (gc *GceCache) GetResourceLimiter() (*cloudprovider.ResourceLimiter, error) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	gc.resourceLimiterMutex.RLock()
+	defer gc.resourceLimiterMutex.RUnlock()
 
 	return gc.resourceLimiter, nil
 }
 
-// GetMigTargetSize returns the cached targetSize for a GceRef
+// GetMigTargetSize returns the cached targetSize for a GceRef, whether it is
+// zonal or regional.
 func (gc *GceCache) GetMigTargetSize(ref GceRef) (int64, bool) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	size, found := gc.migTargetSizeCache[ref]
+	size, found := gc.migTargetSizeCache.Get(ref)
 	if found {
 		klog.V(5).Infof("Target size cache hit for %s", ref)
+		return size, true
+	}
+	size, found = gc.regionalMigTargetSizeCache.Get(ref)
+	if found {
+		klog.V(5).Infof("Regional target size cache hit for %s", ref)
 	}
 	return size, found
 }
 
 // SetMigTargetSize sets targetSize for a GceRef
 func (gc *GceCache) SetMigTargetSize(ref GceRef, size int64) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	gen := gc.generation.Load()
+	if _, isRegional := gc.regionalMigs.Get(ref); isRegional {
+		gc.regionalMigTargetSizeCache.AddGen(ref, size, gen)
+	} else {
+		gc.migTargetSizeCache.AddGen(ref, size, gen)
+	}
 
-	gc.migTargetSizeCache[ref] = size
+	gc.dispatchEvent(func(h CacheEventHandler) { h.OnTargetSizeChanged(ref, size) })
 }
 
 // InvalidateMigTargetSize clears the target size cache
 func (gc *GceCache) InvalidateMigTargetSize(ref GceRef) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	if _, found := gc.migTargetSizeCache[ref]; found {
+	found := gc.migTargetSizeCache.Contains(ref)
+	if found {
 		klog.V(5).Infof("Target size cache invalidated for %s", ref)
-		delete(gc.migTargetSizeCache, ref)
+		gc.migTargetSizeCache.Remove(ref)
+	}
+	regionalFound := gc.regionalMigTargetSizeCache.Contains(ref)
+	if regionalFound {
+		klog.V(5).Infof("Regional target size cache invalidated for %s", ref)
+		gc.regionalMigTargetSizeCache.Remove(ref)
+	}
+
+	if found || regionalFound {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnTargetSizeChanged(ref, -1) })
 	}
 }
 
-// InvalidateAllMigTargetSizes clears the target size cache
+// InvalidateAllMigTargetSizes clears the target size cache, for both zonal
+// and regional migs.
 func (gc *GceCache) InvalidateAllMigTargetSizes() {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
 	klog.V(5).Infof("Target size cache invalidated")
-	gc.migTargetSizeCache = map[GceRef]int64{}
+	refs := gc.migTargetSizeCache.Keys()
+	gc.migTargetSizeCache.Purge()
+	refs = append(refs, gc.regionalMigTargetSizeCache.Keys()...)
+	gc.regionalMigTargetSizeCache.Purge()
+
+	for _, ref := range refs {
+		ref := ref
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnTargetSizeChanged(ref, -1) })
+	}
 }
 
 // GetMigInstanceTemplateName returns the cached instance template ref for a mig GceRef
 func (gc *GceCache) GetMigInstanceTemplateName(ref GceRef) (string, bool) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	templateName, found := gc.instanceTemplateNameCache[ref]
+	templateName, found := gc.instanceTemplateNameCache.Get(ref)
 	if found {
 		klog.V(5).Infof("Instance template names cache hit for %s", ref)
 	}
@@ -299,38 +494,26 @@ func (gc *GceCache) GetMigInstanceTemplateName(ref GceRef) (string, bool) {
 
 // SetMigInstanceTemplateName sets instance template ref for a mig GceRef
 func (gc *GceCache) SetMigInstanceTemplateName(ref GceRef, templateName string) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	gc.instanceTemplateNameCache[ref] = templateName
+	gc.instanceTemplateNameCache.Add(ref, templateName)
 }
 
 // InvalidateMigInstanceTemplateName clears the instance template ref cache for a mig GceRef
 func (gc *GceCache) InvalidateMigInstanceTemplateName(ref GceRef) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	if _, found := gc.instanceTemplateNameCache[ref]; found {
+	if gc.instanceTemplateNameCache.Contains(ref) {
 		klog.V(5).Infof("Instance template names cache invalidated for %s", ref)
-		delete(gc.instanceTemplateNameCache, ref)
+		gc.instanceTemplateNameCache.Remove(ref)
 	}
 }
 
 // InvalidateAllMigInstanceTemplateNames clears the instance template ref cache
 func (gc *GceCache) InvalidateAllMigInstanceTemplateNames() {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
 	klog.V(5).Infof("Instance template names cache invalidated")
-	gc.instanceTemplateNameCache = map[GceRef]string{}
+	gc.instanceTemplateNameCache.Purge()
 }
 
 // GetMigInstanceTemplate returns the cached gce.InstanceTemplate for a mig GceRef
 func (gc *GceCache) GetMigInstanceTemplate(ref GceRef) (*gce.InstanceTemplate, bool) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	instanceTemplate, found := gc.instanceTemplatesCache[ref]
+	instanceTemplate, found := gc.instanceTemplatesCache.Get(ref)
 	if found {
 		klog.V(5).Infof("Instance template cache hit for %s", ref)
 	}
@@ -339,38 +522,39 @@ func (gc *GceCache) GetMigInstanceTemplate(ref GceRef) (*gce.InstanceTemplate, b
 
 // SetMigInstanceTemplate sets gce.InstanceTemplate for a mig GceRef
 func (gc *GceCache) SetMigInstanceTemplate(ref GceRef, instanceTemplate *gce.InstanceTemplate) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	gc.instanceTemplatesCache.Add(ref, instanceTemplate)
 
-	gc.instanceTemplatesCache[ref] = instanceTemplate
+	gc.dispatchEvent(func(h CacheEventHandler) { h.OnInstanceTemplateChanged(ref, instanceTemplate) })
 }
 
 // InvalidateMigInstanceTemplate clears the instance template cache for a mig GceRef
 func (gc *GceCache) InvalidateMigInstanceTemplate(ref GceRef) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	if _, found := gc.instanceTemplatesCache[ref]; found {
+	found := gc.instanceTemplatesCache.Contains(ref)
+	if found {
 		klog.V(5).Infof("Instance template cache invalidated for %s", ref)
-		delete(gc.instanceTemplatesCache, ref)
+		gc.instanceTemplatesCache.Remove(ref)
+	}
+
+	if found {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnInstanceTemplateChanged(ref, nil) })
 	}
 }
 
 // InvalidateAllMigInstanceTemplates clears the instance template cache
 func (gc *GceCache) InvalidateAllMigInstanceTemplates() {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
 	klog.V(5).Infof("Instance template cache invalidated")
-	gc.instanceTemplatesCache = map[GceRef]*gce.InstanceTemplate{}
+	refs := gc.instanceTemplatesCache.Keys()
+	gc.instanceTemplatesCache.Purge()
+
+	for _, ref := range refs {
+		ref := ref
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnInstanceTemplateChanged(ref, nil) })
+	}
 }
 
-// GetMachineFromCache retrieves machine type from cache under lock.
+// GetMachineFromCache retrieves machine type from cache.
 func (gc *GceCache) GetMachineFromCache(machineType string, zone string) (*gce.MachineType, error) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	cv, ok := gc.machinesCache[MachineTypeKey{zone, machineType}]
+	cv, ok := gc.machinesCache.Get(MachineTypeKey{zone, machineType})
 	if !ok {
 		return nil, nil
 	}
@@ -380,58 +564,61 @@ func (gc *GceCache) GetMachineFromCache(machineType string, zone string) (*gce.M
 	return cv.machineType, nil
 }
 
-// AddMachineToCache adds machine to cache under lock.
+// AddMachineToCache adds machine to cache.
 func (gc *GceCache) AddMachineToCache(machineType string, zone string, machine *gce.MachineType) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	gc.machinesCache[MachineTypeKey{zone, machineType}] = machinesCacheValue{machineType: machine}
+	gc.machinesCache.Add(MachineTypeKey{zone, machineType}, machinesCacheValue{machineType: machine})
 }
 
-// AddMachineToCacheWithError adds machine to cache under lock.
+// AddMachineToCacheWithError adds machine to cache.
 func (gc *GceCache) AddMachineToCacheWithError(machineType string, zone string, err error) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-
-	gc.machinesCache[MachineTypeKey{zone, machineType}] = machinesCacheValue{err: err}
+	gc.machinesCache.Add(MachineTypeKey{zone, machineType}, machinesCacheValue{err: err})
 }
 
-// SetMachinesCache sets the machines cache under lock.
+// SetMachinesCache replaces the machines cache, inserting the new entries by
+// fanning writes out across shards in parallel.
 func (gc *GceCache) SetMachinesCache(machinesCache map[MachineTypeKey]*gce.MachineType) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
+	gc.machinesCache.Purge()
 
-	gc.machinesCache = map[MachineTypeKey]machinesCacheValue{}
+	entries := make(map[MachineTypeKey]machinesCacheValue, len(machinesCache))
 	for k, v := range machinesCache {
-		gc.machinesCache[k] = machinesCacheValue{machineType: v}
+		entries[k] = machinesCacheValue{machineType: v}
 	}
+	gc.machinesCache.AddBatch(entries)
 }
 
 // SetMigBasename sets basename for given mig in cache
 func (gc *GceCache) SetMigBasename(migRef GceRef, basename string) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-	gc.migBaseNameCache[migRef] = basename
+	gc.migBaseNameCache.Add(migRef, basename)
 }
 
 // GetMigBasename get basename for given mig from cache.
 func (gc *GceCache) GetMigBasename(migRef GceRef) (basename string, found bool) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-	basename, found = gc.migBaseNameCache[migRef]
-	return
+	return gc.migBaseNameCache.Get(migRef)
 }
 
 // InvalidateMigBasename invalidates basename entry for given mig.
 func (gc *GceCache) InvalidateMigBasename(migRef GceRef) {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-	delete(gc.migBaseNameCache, migRef)
+	gc.migBaseNameCache.Remove(migRef)
 }
 
 // InvalidateAllMigBasenames invalidates all basename entries.
 func (gc *GceCache) InvalidateAllMigBasenames() {
-	gc.cacheMutex.Lock()
-	defer gc.cacheMutex.Unlock()
-	gc.migBaseNameCache = make(map[GceRef]string)
+	gc.migBaseNameCache.Purge()
+}
+
+// CacheMetrics reports hit/miss/eviction/expiration counters for each of the
+// GCE API result sub-caches, keyed by sub-cache name (e.g. "machines",
+// "migTargetSize"), summed across all of that sub-cache's shards. Useful for
+// exporting as autoscaler metrics or for debugging cache effectiveness in
+// long-running clusters.
+func (gc *GceCache) CacheMetrics() map[string]CacheMetricsSnapshot {
+	return map[string]CacheMetricsSnapshot{
+		"autoscalingOptions":    gc.autoscalingOptionsCache.Metrics(),
+		"machines":              gc.machinesCache.Metrics(),
+		"migTargetSize":         gc.migTargetSizeCache.Metrics(),
+		"migBasename":           gc.migBaseNameCache.Metrics(),
+		"instanceTemplateName":  gc.instanceTemplateNameCache.Metrics(),
+		"instanceTemplate":      gc.instanceTemplatesCache.Metrics(),
+		"regionalMigTargetSize": gc.regionalMigTargetSizeCache.Metrics(),
+	}
 }
@@ -0,0 +1,145 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"reflect"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+
+	klog "k8s.io/klog/v2"
+)
+
+// MigScope identifies whether a Mig tracked by GceCache is confined to a
+// single zone or spans every zone of a region.
+type MigScope int
+
+const (
+	// ZonalMigScope is a Mig confined to a single zone.
+	ZonalMigScope MigScope = iota
+	// RegionalMigScope is a Mig that spans every zone in a region, backed
+	// by constituent zonal instance groups GCE manages transparently.
+	RegionalMigScope
+)
+
+func (s MigScope) String() string {
+	if s == RegionalMigScope {
+		return "Regional"
+	}
+	return "Zonal"
+}
+
+// GetMigScope returns the scope under which migRef is registered.
+func (gc *GceCache) GetMigScope(migRef GceRef) (MigScope, bool) {
+	if _, found := gc.migs.Get(migRef); found {
+		return ZonalMigScope, true
+	}
+	if _, found := gc.regionalMigs.Get(migRef); found {
+		return RegionalMigScope, true
+	}
+	return ZonalMigScope, false
+}
+
+// RegisterRegionalMig returns true if the regional node group wasn't in
+// cache before, or its config was updated. Mirrors RegisterMig, but for a
+// Mig that spans every zone of a region rather than a single zone.
+func (gc *GceCache) RegisterRegionalMig(newMig Mig) bool {
+	changed := gc.regionalMigs.Update(newMig.GceRef(), func(old Mig, found bool) (Mig, bool) {
+		if !found {
+			klog.V(1).Infof("Registering regional %s", newMig.GceRef().String())
+			return newMig, true
+		}
+		if !reflect.DeepEqual(old, newMig) {
+			klog.V(4).Infof("Updated regional Mig %s", newMig.GceRef().String())
+			return newMig, true
+		}
+		return old, false
+	})
+	if changed {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigRegistered(newMig) })
+	}
+	return changed
+}
+
+// UnregisterRegionalMig returns true if the regional node group has been
+// removed, and false if it was already missing from cache.
+func (gc *GceCache) UnregisterRegionalMig(toBeRemoved Mig) bool {
+	if !gc.regionalMigs.DeleteIfPresent(toBeRemoved.GceRef()) {
+		return false
+	}
+	klog.V(1).Infof("Unregistered regional Mig %s", toBeRemoved.GceRef().String())
+	removed := gc.removeRegionalMigInstances(toBeRemoved.GceRef())
+
+	gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigUnregistered(toBeRemoved) })
+	if len(removed) > 0 {
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(toBeRemoved.GceRef(), nil, removed) })
+	}
+	return true
+}
+
+// setRegionalMigInstances is the regional counterpart of the instance
+// bookkeeping SetMigInstances does for a zonal Mig: it replaces the set of
+// instances tracked under migRef, accepting instances from any zone in the
+// region, and refreshes the per-zone distribution used by
+// GetRegionalMigDistribution.
+func (gc *GceCache) setRegionalMigInstances(migRef GceRef, instances []cloudprovider.Instance) (added, removed []GceRef, err error) {
+	removed = gc.removeRegionalMigInstances(migRef)
+
+	added = make([]GceRef, 0, len(instances))
+	distribution := make(map[string]int64)
+	for _, instance := range instances {
+		instanceRef, err := GceRefFromProviderId(instance.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		gc.instancesFromUnknownMig.Delete(instanceRef)
+		gc.instancesToRegionalMig.Set(instanceRef, migRef)
+		added = append(added, instanceRef)
+		distribution[instanceRef.Zone]++
+	}
+	gc.regionalMigToInstances.Set(migRef, added)
+	gc.regionalMigZoneDistribution.Set(migRef, distribution)
+	return added, removed, nil
+}
+
+// removeRegionalMigInstances removes every instance mapped to migRef from
+// the regional instance caches and returns the refs that were removed.
+// Looking the instances up through regionalMigToInstances, rather than
+// scanning instancesToRegionalMig for matches, means this only ever touches
+// the shards holding migRef's own instances.
+func (gc *GceCache) removeRegionalMigInstances(migRef GceRef) []GceRef {
+	removed, _ := gc.regionalMigToInstances.Get(migRef)
+	gc.regionalMigToInstances.Delete(migRef)
+	for _, instanceRef := range removed {
+		gc.instancesToRegionalMig.Delete(instanceRef)
+		gc.instancesFromUnknownMig.Delete(instanceRef)
+	}
+	gc.regionalMigZoneDistribution.Delete(migRef)
+	return removed
+}
+
+// GetRegionalMigDistribution returns the number of cached instances per zone
+// for a regional Mig, so the autoscaler can make zone-balanced expansion
+// decisions. Returns an empty map if migRef isn't a known regional Mig.
+func (gc *GceCache) GetRegionalMigDistribution(migRef GceRef) map[string]int64 {
+	stored, _ := gc.regionalMigZoneDistribution.Get(migRef)
+	distribution := make(map[string]int64, len(stored))
+	for zone, count := range stored {
+		distribution[zone] = count
+	}
+	return distribution
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"testing"
+
+	gce "google.golang.org/api/compute/v1"
+)
+
+// recordingEventHandler implements CacheEventHandler, recording every
+// OnMigInstancesChanged call it receives so tests can assert on dispatch.
+type recordingEventHandler struct {
+	instancesChanged []instancesChangedCall
+}
+
+type instancesChangedCall struct {
+	migRef  GceRef
+	added   []GceRef
+	removed []GceRef
+}
+
+func (h *recordingEventHandler) OnMigRegistered(mig Mig)       {}
+func (h *recordingEventHandler) OnMigUnregistered(mig Mig)     {}
+func (h *recordingEventHandler) OnInstanceTemplateChanged(migRef GceRef, template *gce.InstanceTemplate) {
+}
+func (h *recordingEventHandler) OnTargetSizeChanged(migRef GceRef, targetSize int64) {}
+
+func (h *recordingEventHandler) OnMigInstancesChanged(migRef GceRef, added, removed []GceRef) {
+	h.instancesChanged = append(h.instancesChanged, instancesChangedCall{migRef: migRef, added: added, removed: removed})
+}
+
+func TestGetRegionalMigDistribution(t *testing.T) {
+	gc := NewGceCache()
+	migRef := GceRef{Project: "p", Zone: "", Name: "regional-mig"}
+
+	if dist := gc.GetRegionalMigDistribution(migRef); len(dist) != 0 {
+		t.Fatalf("GetRegionalMigDistribution for unknown mig = %v, want empty", dist)
+	}
+
+	instances := []struct {
+		zone string
+		name string
+	}{
+		{"us-central1-a", "i1"},
+		{"us-central1-a", "i2"},
+		{"us-central1-b", "i3"},
+	}
+	for _, inst := range instances {
+		instanceRef := GceRef{Project: "p", Zone: inst.zone, Name: inst.name}
+		gc.instancesToRegionalMig.Set(instanceRef, migRef)
+	}
+	distribution := map[string]int64{"us-central1-a": 2, "us-central1-b": 1}
+	gc.regionalMigZoneDistribution.Set(migRef, distribution)
+
+	got := gc.GetRegionalMigDistribution(migRef)
+	if got["us-central1-a"] != 2 || got["us-central1-b"] != 1 {
+		t.Fatalf("GetRegionalMigDistribution() = %v, want %v", got, distribution)
+	}
+
+	// The returned map must be a copy: mutating it shouldn't affect the cache.
+	got["us-central1-a"] = 99
+	if fresh := gc.GetRegionalMigDistribution(migRef); fresh["us-central1-a"] != 2 {
+		t.Fatalf("GetRegionalMigDistribution() returned a live reference, mutation leaked: %v", fresh)
+	}
+}
+
+func TestInvalidateAllInstancesToMigClearsRegionalState(t *testing.T) {
+	gc := NewGceCache()
+	handler := &recordingEventHandler{}
+	reg, err := gc.AddEventHandler(handler)
+	if err != nil {
+		t.Fatalf("AddEventHandler: %v", err)
+	}
+
+	zonalMig := GceRef{Project: "p", Zone: "us-central1-a", Name: "zonal-mig"}
+	regionalMig := GceRef{Project: "p", Zone: "", Name: "regional-mig"}
+	zonalInstance := GceRef{Project: "p", Zone: "us-central1-a", Name: "zonal-instance"}
+	regionalInstance := GceRef{Project: "p", Zone: "us-central1-b", Name: "regional-instance"}
+
+	gc.instancesToMig.Set(zonalInstance, zonalMig)
+	gc.instancesToRegionalMig.Set(regionalInstance, regionalMig)
+	gc.regionalMigZoneDistribution.Set(regionalMig, map[string]int64{"us-central1-b": 1})
+
+	gc.InvalidateAllInstancesToMig()
+
+	if _, found := gc.GetMigForInstance(zonalInstance); found {
+		t.Errorf("GetMigForInstance(zonalInstance) found after InvalidateAllInstancesToMig")
+	}
+	if _, found := gc.GetMigForInstance(regionalInstance); found {
+		t.Errorf("GetMigForInstance(regionalInstance) found after InvalidateAllInstancesToMig")
+	}
+	if dist := gc.GetRegionalMigDistribution(regionalMig); len(dist) != 0 {
+		t.Errorf("GetRegionalMigDistribution(regionalMig) = %v after InvalidateAllInstancesToMig, want empty", dist)
+	}
+
+	// Events are delivered on a background goroutine; Stop drains the
+	// subscriber's queue before returning.
+	reg.Stop()
+
+	var sawZonal, sawRegional bool
+	for _, call := range handler.instancesChanged {
+		if call.migRef == zonalMig {
+			sawZonal = true
+		}
+		if call.migRef == regionalMig {
+			sawRegional = true
+		}
+	}
+	if !sawZonal {
+		t.Errorf("no OnMigInstancesChanged event for zonal mig %v", zonalMig)
+	}
+	if !sawRegional {
+		t.Errorf("no OnMigInstancesChanged event for regional mig %v, regional invalidation must notify handlers like the zonal path does", regionalMig)
+	}
+}
+
+func TestRemoveRegionalMigInstancesOnlyTouchesOwnKeys(t *testing.T) {
+	gc := NewGceCache()
+
+	migA := GceRef{Project: "p", Zone: "", Name: "regional-a"}
+	migB := GceRef{Project: "p", Zone: "", Name: "regional-b"}
+	instanceA1 := GceRef{Project: "p", Zone: "us-central1-a", Name: "a1"}
+	instanceB1 := GceRef{Project: "p", Zone: "us-central1-b", Name: "b1"}
+
+	gc.instancesToRegionalMig.Set(instanceA1, migA)
+	gc.instancesToRegionalMig.Set(instanceB1, migB)
+	gc.regionalMigToInstances.Set(migA, []GceRef{instanceA1})
+	gc.regionalMigToInstances.Set(migB, []GceRef{instanceB1})
+	gc.regionalMigZoneDistribution.Set(migA, map[string]int64{"us-central1-a": 1})
+	gc.regionalMigZoneDistribution.Set(migB, map[string]int64{"us-central1-b": 1})
+
+	removed := gc.removeRegionalMigInstances(migA)
+
+	if len(removed) != 1 || removed[0] != instanceA1 {
+		t.Fatalf("removeRegionalMigInstances(migA) = %v, want [%v]", removed, instanceA1)
+	}
+	if _, found := gc.GetMigForInstance(instanceA1); found {
+		t.Errorf("instanceA1 still mapped after removeRegionalMigInstances(migA)")
+	}
+	if migRef, found := gc.GetMigForInstance(instanceB1); !found || migRef != migB {
+		t.Errorf("GetMigForInstance(instanceB1) = %v, %v, want %v, true (unrelated regional mig's instances must be untouched)", migRef, found, migB)
+	}
+	if dist := gc.GetRegionalMigDistribution(migB); dist["us-central1-b"] != 1 {
+		t.Errorf("GetRegionalMigDistribution(migB) = %v after removing migA's instances, want unchanged", dist)
+	}
+}
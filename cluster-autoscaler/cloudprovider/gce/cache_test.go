@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import "testing"
+
+// TestRemoveMigInstancesOnlyTouchesOwnKeys exercises removeMigInstances
+// through the migToInstances reverse index, rather than a full scan of
+// instancesToMig, and checks that an unrelated MIG's instances are left
+// completely untouched.
+func TestRemoveMigInstancesOnlyTouchesOwnKeys(t *testing.T) {
+	gc := NewGceCache()
+
+	migA := GceRef{Project: "p", Zone: "us-central1-a", Name: "mig-a"}
+	migB := GceRef{Project: "p", Zone: "us-central1-a", Name: "mig-b"}
+	instanceA1 := GceRef{Project: "p", Zone: "us-central1-a", Name: "a1"}
+	instanceA2 := GceRef{Project: "p", Zone: "us-central1-a", Name: "a2"}
+	instanceB1 := GceRef{Project: "p", Zone: "us-central1-a", Name: "b1"}
+
+	gc.instancesToMig.Set(instanceA1, migA)
+	gc.instancesToMig.Set(instanceA2, migA)
+	gc.instancesToMig.Set(instanceB1, migB)
+	gc.migToInstances.Set(migA, []GceRef{instanceA1, instanceA2})
+	gc.migToInstances.Set(migB, []GceRef{instanceB1})
+
+	removed := gc.removeMigInstances(migA)
+
+	if len(removed) != 2 {
+		t.Fatalf("removeMigInstances(migA) removed %v, want 2 entries", removed)
+	}
+	if _, found := gc.GetMigForInstance(instanceA1); found {
+		t.Errorf("instanceA1 still mapped to a mig after removeMigInstances(migA)")
+	}
+	if _, found := gc.GetMigForInstance(instanceA2); found {
+		t.Errorf("instanceA2 still mapped to a mig after removeMigInstances(migA)")
+	}
+	migRef, found := gc.GetMigForInstance(instanceB1)
+	if !found || migRef != migB {
+		t.Errorf("GetMigForInstance(instanceB1) = %v, %v, want %v, true (unrelated mig's instances must be untouched)", migRef, found, migB)
+	}
+	if remaining, _ := gc.migToInstances.Get(migB); len(remaining) != 1 {
+		t.Errorf("migToInstances[migB] = %v after removing migA's instances, want unchanged", remaining)
+	}
+}
+
+// TestSetMigInstancesReplacesPriorSet checks the replacement step that a
+// second SetMigInstances call for the same MIG performs: removeMigInstances
+// drops the prior set through the migToInstances reverse index and the new
+// set is indexed in its place, so an instance that dropped out of the new set
+// is no longer mapped. The test drives the maps directly rather than calling
+// SetMigInstances.
+func TestSetMigInstancesReplacesPriorSet(t *testing.T) {
+	gc := NewGceCache()
+	mig := GceRef{Project: "p", Zone: "us-central1-a", Name: "mig"}
+	first := GceRef{Project: "p", Zone: "us-central1-a", Name: "first"}
+	second := GceRef{Project: "p", Zone: "us-central1-a", Name: "second"}
+
+	gc.instancesToMig.Set(first, mig)
+	gc.migToInstances.Set(mig, []GceRef{first})
+
+	removed := gc.removeMigInstances(mig)
+	if len(removed) != 1 || removed[0] != first {
+		t.Fatalf("removeMigInstances(mig) = %v, want [%v]", removed, first)
+	}
+	gc.instancesToMig.Set(second, mig)
+	gc.migToInstances.Set(mig, []GceRef{second})
+
+	if _, found := gc.GetMigForInstance(first); found {
+		t.Errorf("GetMigForInstance(first) found after it was replaced out of mig's instance set")
+	}
+	if migRef, found := gc.GetMigForInstance(second); !found || migRef != mig {
+		t.Errorf("GetMigForInstance(second) = %v, %v, want %v, true", migRef, found, mig)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+
+	gce "google.golang.org/api/compute/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// CacheEventHandler can be registered with GceCache.AddEventHandler to react
+// to cache changes instead of polling it. Implementations must not block:
+// handler methods are invoked sequentially for a single subscriber from a
+// dedicated goroutine, so a slow handler only delays its own events, but a
+// handler that never returns will eventually fill its event queue and start
+// losing events.
+type CacheEventHandler interface {
+	// OnMigRegistered is called when a MIG is added to the cache, or when
+	// an already registered MIG's config changes.
+	OnMigRegistered(mig Mig)
+	// OnMigUnregistered is called when a MIG is removed from the cache.
+	OnMigUnregistered(mig Mig)
+	// OnMigInstancesChanged is called when the set of instances tracked
+	// under migRef changes. added and removed list instances that
+	// respectively started and stopped being associated with migRef; at
+	// least one of them is non-empty.
+	OnMigInstancesChanged(migRef GceRef, added, removed []GceRef)
+	// OnInstanceTemplateChanged is called when the cached instance
+	// template for migRef is set or invalidated. template is nil when the
+	// cached value was invalidated rather than replaced with a new one.
+	OnInstanceTemplateChanged(migRef GceRef, template *gce.InstanceTemplate)
+	// OnTargetSizeChanged is called when the cached target size for
+	// migRef is set or invalidated. targetSize is -1 when the cached
+	// value was invalidated rather than replaced with a new one.
+	OnTargetSizeChanged(migRef GceRef, targetSize int64)
+}
+
+// Registration is returned by GceCache.AddEventHandler. Callers should hold
+// onto it and call Stop when they no longer want to receive events.
+type Registration interface {
+	// Stop unregisters the handler. Events already queued for delivery
+	// before Stop is called are delivered before Stop returns.
+	Stop()
+}
+
+// eventQueueLength bounds how many pending events a single subscriber can
+// accumulate before new events are dropped for it. It exists so that one
+// slow or stuck subscriber can't grow memory without bound or block cache
+// mutators.
+const eventQueueLength = 64
+
+// cacheEvent is a closure over a single invocation of a CacheEventHandler
+// method, so that the dispatch machinery doesn't need a variant per event
+// type.
+type cacheEvent func(CacheEventHandler)
+
+type eventSubscriber struct {
+	id      int64
+	handler CacheEventHandler
+	queue   chan cacheEvent
+	done    chan struct{}
+}
+
+func newEventSubscriber(id int64, handler CacheEventHandler) *eventSubscriber {
+	s := &eventSubscriber{
+		id:      id,
+		handler: handler,
+		queue:   make(chan cacheEvent, eventQueueLength),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *eventSubscriber) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		event(s.handler)
+	}
+}
+
+// stop closes the subscriber's queue and waits for its goroutine to drain
+// any events already queued.
+func (s *eventSubscriber) stop() {
+	close(s.queue)
+	<-s.done
+}
+
+type cacheEventRegistration struct {
+	gc *GceCache
+	id int64
+}
+
+func (r *cacheEventRegistration) Stop() {
+	r.gc.removeEventHandler(r.id)
+}
+
+// AddEventHandler registers handler to receive cache change events on a
+// dedicated background goroutine and returns a Registration that can be used
+// to stop receiving them. Returns an error if handler is nil.
+func (gc *GceCache) AddEventHandler(handler CacheEventHandler) (Registration, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("cannot register a nil CacheEventHandler")
+	}
+
+	gc.eventMutex.Lock()
+	defer gc.eventMutex.Unlock()
+
+	gc.nextSubscriberID++
+	id := gc.nextSubscriberID
+	gc.eventSubscribers[id] = newEventSubscriber(id, handler)
+	return &cacheEventRegistration{gc: gc, id: id}, nil
+}
+
+func (gc *GceCache) removeEventHandler(id int64) {
+	gc.eventMutex.Lock()
+	sub, found := gc.eventSubscribers[id]
+	if found {
+		delete(gc.eventSubscribers, id)
+	}
+	gc.eventMutex.Unlock()
+
+	if found {
+		sub.stop()
+	}
+}
+
+// dispatchEvent fans event out to every registered subscriber's queue. It
+// never blocks: a subscriber whose queue is full has the event dropped for
+// it, with a warning logged.
+func (gc *GceCache) dispatchEvent(event cacheEvent) {
+	gc.eventMutex.RLock()
+	defer gc.eventMutex.RUnlock()
+
+	for _, sub := range gc.eventSubscribers {
+		select {
+		case sub.queue <- event:
+		default:
+			klog.Warningf("GceCache event queue full for subscriber %d, dropping event", sub.id)
+		}
+	}
+}
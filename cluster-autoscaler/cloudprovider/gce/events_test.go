@@ -0,0 +1,144 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	gce "google.golang.org/api/compute/v1"
+)
+
+func TestDispatchEventDeliversToAllSubscribersInOrder(t *testing.T) {
+	gc := NewGceCache()
+	handlerA := &recordingEventHandler{}
+	handlerB := &recordingEventHandler{}
+	regA, err := gc.AddEventHandler(handlerA)
+	if err != nil {
+		t.Fatalf("AddEventHandler(handlerA): %v", err)
+	}
+	regB, err := gc.AddEventHandler(handlerB)
+	if err != nil {
+		t.Fatalf("AddEventHandler(handlerB): %v", err)
+	}
+
+	var migRefs []GceRef
+	for i := 0; i < 5; i++ {
+		migRef := GceRef{Project: "p", Zone: "us-central1-a", Name: fmt.Sprintf("mig-%d", i)}
+		migRefs = append(migRefs, migRef)
+		gc.dispatchEvent(func(h CacheEventHandler) { h.OnMigInstancesChanged(migRef, nil, nil) })
+	}
+
+	// Stop drains each subscriber's queue before returning.
+	regA.Stop()
+	regB.Stop()
+
+	for _, handler := range []*recordingEventHandler{handlerA, handlerB} {
+		if len(handler.instancesChanged) != len(migRefs) {
+			t.Fatalf("got %d events, want %d", len(handler.instancesChanged), len(migRefs))
+		}
+		for i, call := range handler.instancesChanged {
+			if call.migRef != migRefs[i] {
+				t.Errorf("event %d migRef = %v, want %v (events must be delivered in dispatch order)", i, call.migRef, migRefs[i])
+			}
+		}
+	}
+}
+
+// blockingEventHandler blocks its first call on proceed, closing started once
+// it has been invoked, so a test can deterministically fill a subscriber's
+// event queue while its delivery goroutine is stuck processing the first
+// event.
+type blockingEventHandler struct {
+	started   chan struct{}
+	proceed   chan struct{}
+	blockOnce sync.Once
+
+	mu       sync.Mutex
+	received []GceRef
+}
+
+func newBlockingEventHandler() *blockingEventHandler {
+	return &blockingEventHandler{
+		started: make(chan struct{}),
+		proceed: make(chan struct{}),
+	}
+}
+
+func (h *blockingEventHandler) OnMigRegistered(mig Mig)   {}
+func (h *blockingEventHandler) OnMigUnregistered(mig Mig) {}
+func (h *blockingEventHandler) OnInstanceTemplateChanged(migRef GceRef, template *gce.InstanceTemplate) {
+}
+func (h *blockingEventHandler) OnMigInstancesChanged(migRef GceRef, added, removed []GceRef) {}
+
+func (h *blockingEventHandler) OnTargetSizeChanged(migRef GceRef, targetSize int64) {
+	h.blockOnce.Do(func() {
+		close(h.started)
+		<-h.proceed
+	})
+	h.mu.Lock()
+	h.received = append(h.received, migRef)
+	h.mu.Unlock()
+}
+
+func TestDispatchEventDropsWhenSubscriberQueueIsFull(t *testing.T) {
+	gc := NewGceCache()
+	handler := newBlockingEventHandler()
+	reg, err := gc.AddEventHandler(handler)
+	if err != nil {
+		t.Fatalf("AddEventHandler: %v", err)
+	}
+
+	targetSizeEvent := func(migRef GceRef) cacheEvent {
+		return func(h CacheEventHandler) { h.OnTargetSizeChanged(migRef, 1) }
+	}
+
+	blocked := GceRef{Project: "p", Zone: "us-central1-a", Name: "blocked"}
+	gc.dispatchEvent(targetSizeEvent(blocked))
+	<-handler.started // the event above is now stuck inside the handler
+
+	var queued []GceRef
+	for i := 0; i < eventQueueLength; i++ {
+		migRef := GceRef{Project: "p", Zone: "us-central1-a", Name: fmt.Sprintf("queued-%d", i)}
+		queued = append(queued, migRef)
+		gc.dispatchEvent(targetSizeEvent(migRef))
+	}
+
+	// The subscriber's queue is now full; these must be dropped rather than
+	// dispatchEvent blocking or growing the queue without bound.
+	for i := 0; i < 10; i++ {
+		gc.dispatchEvent(targetSizeEvent(GceRef{Project: "p", Zone: "us-central1-a", Name: fmt.Sprintf("dropped-%d", i)}))
+	}
+
+	close(handler.proceed)
+	reg.Stop() // waits for the queue to fully drain
+
+	want := append([]GceRef{blocked}, queued...)
+	handler.mu.Lock()
+	got := handler.received
+	handler.mu.Unlock()
+
+	if len(got) != len(want) {
+		t.Fatalf("delivered %d events, want %d (queue should hold the blocked event plus %d queued ones, dropping the rest)", len(got), len(want), eventQueueLength)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("delivered event %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
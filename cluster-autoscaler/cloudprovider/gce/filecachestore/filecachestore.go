@@ -0,0 +1,95 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filecachestore provides a gce.CacheStore backed by a single JSON
+// file on local disk. It's meant for single-replica cluster-autoscaler
+// deployments that want faster cold starts without standing up external
+// storage; deployments that run multiple replicas or want the snapshot to
+// survive node loss should implement gce.CacheStore against their own
+// shared storage instead.
+package filecachestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/gce"
+)
+
+// Store is a gce.CacheStore that persists snapshots as JSON to a single file
+// path.
+type Store struct {
+	path string
+}
+
+// New returns a Store that reads and writes snapshots at path. path's
+// parent directory must already exist.
+func New(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load reads the snapshot from disk. A missing file is treated as "no
+// snapshot yet" rather than an error, so a Store can be pointed at a path
+// that doesn't exist on first run.
+func (s *Store) Load(ctx context.Context) (gce.Snapshot, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return gce.Snapshot{}, nil
+		}
+		return gce.Snapshot{}, fmt.Errorf("reading cache snapshot %q: %w", s.path, err)
+	}
+
+	var snapshot gce.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return gce.Snapshot{}, fmt.Errorf("parsing cache snapshot %q: %w", s.path, err)
+	}
+	return snapshot, nil
+}
+
+// Save writes snapshot to disk as JSON. It writes to a temporary file in the
+// same directory first and renames it into place, so that a reader never
+// observes a partially written file and a crash mid-write can't corrupt the
+// previously saved snapshot.
+func (s *Store) Save(ctx context.Context, snapshot gce.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding cache snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file for cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing cache snapshot %q: %w", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temp file for cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("renaming cache snapshot into place at %q: %w", s.path, err)
+	}
+	return nil
+}
+
+var _ gce.CacheStore = (*Store)(nil)
@@ -0,0 +1,46 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+// Generation returns the cache's current generation counter. It starts at 0
+// and is bumped once per successful Refresher.RefreshMigs pass (see
+// refresher.go) - a pass that fails partway through never bumps it - so
+// callers can tell whether a cached value reflects a particular completed
+// refresh pass or an earlier, possibly stale, one.
+func (gc *GceCache) Generation() int64 {
+	return gc.generation.Load()
+}
+
+// bumpGeneration increments and returns the cache generation counter.
+func (gc *GceCache) bumpGeneration() int64 {
+	return gc.generation.Add(1)
+}
+
+// GetMigTargetSizeAtLeast returns the cached target size for ref, but only
+// if it was written at cache generation gen or later; a target size written
+// at an earlier generation is treated as a miss, even though a value exists
+// in the cache. A target size is stamped with the value of Generation() at
+// the time SetMigTargetSize is called, and a RefreshMigs pass only bumps the
+// counter once it completes, so after a pass has completed at generation gen
+// this accepts only target sizes written since that pass completed, not
+// ones written while it was still running or before it.
+func (gc *GceCache) GetMigTargetSizeAtLeast(ref GceRef, gen int64) (int64, bool) {
+	if size, found := gc.migTargetSizeCache.GetAtLeast(ref, gen); found {
+		return size, true
+	}
+	return gc.regionalMigTargetSizeCache.GetAtLeast(ref, gen)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+
+	klog "k8s.io/klog/v2"
+)
+
+// RefreshProgress reports progress of a single RefreshMigs pass, delivered
+// through a RefreshProgressHandler as each page is applied to the cache.
+type RefreshProgress struct {
+	// PagesProcessed is the number of pages applied to the cache so far in
+	// this pass, including the one that just completed.
+	PagesProcessed int
+	// MigsProcessed is the cumulative number of Migs applied so far in
+	// this pass.
+	MigsProcessed int
+	// Generation is the cache generation this pass advances the cache to
+	// once it completes, see GceCache.Generation. GceCache.Generation only
+	// returns this value from the final (Done) report on.
+	Generation int64
+	// Done is true on the final progress report of a pass, once every page
+	// has been applied.
+	Done bool
+}
+
+// RefreshProgressHandler is notified as Refresher.RefreshMigs makes
+// progress through a refresh pass. Implementations must not block:
+// OnRefreshProgress is called synchronously from the refresh loop, so a
+// slow handler directly slows the refresh down.
+type RefreshProgressHandler interface {
+	OnRefreshProgress(progress RefreshProgress)
+}
+
+// MigPageFetcher returns one page of up to pageSize Migs starting at
+// pageToken, and the token to pass back in to fetch the next page, which is
+// empty once the last page has been returned.
+type MigPageFetcher func(ctx context.Context, pageToken string, pageSize int) (migs []Mig, nextPageToken string, err error)
+
+// Refresher drives paged, rate-limited, incremental refreshes of a GceCache
+// from a MigPageFetcher. Unlike a refresh that lists every Mig in the
+// cluster before writing any of them to the cache, Refresher applies each
+// page as soon as it's fetched, so the cache starts reflecting fresh data
+// before the whole pass finishes, and a refresh of a large cluster never
+// needs to hold every Mig in memory at once.
+type Refresher struct {
+	cache    *GceCache
+	fetch    MigPageFetcher
+	progress RefreshProgressHandler
+}
+
+// NewRefresher creates a Refresher that applies pages fetched via fetch to
+// cache. progress may be nil if the caller doesn't want progress reports.
+func NewRefresher(cache *GceCache, fetch MigPageFetcher, progress RefreshProgressHandler) *Refresher {
+	return &Refresher{cache: cache, fetch: fetch, progress: progress}
+}
+
+// RefreshMigs fetches every page of Migs from the Refresher's
+// MigPageFetcher and applies each one to the cache via RegisterMig as soon
+// as it arrives, rather than collecting every Mig in memory before writing
+// any of them. rateLimit caps how fast pages are fetched, providing
+// backpressure against the GCE API; pass rate.Inf to disable limiting.
+// Returns once every page has been applied, or on the first error from
+// fetch or from the context being cancelled.
+func (r *Refresher) RefreshMigs(ctx context.Context, pageSize int, rateLimit rate.Limit) error {
+	if pageSize <= 0 {
+		return fmt.Errorf("pageSize must be positive, got %d", pageSize)
+	}
+
+	limiter := rate.NewLimiter(rateLimit, 1)
+	// The generation this pass will advance the cache to, once it finishes
+	// successfully. Reported in every progress event, but the counter
+	// itself isn't bumped until the
+	// pass actually completes (see below) - a pass that fails partway
+	// through must not advance Generation(), or a freshness check like
+	// GetMigTargetSizeAtLeast could be satisfied by a pass that never
+	// finished.
+	generation := r.cache.Generation() + 1
+
+	var pageToken string
+	pagesProcessed := 0
+	migsProcessed := 0
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("waiting for refresh rate limiter: %w", err)
+		}
+
+		migs, nextPageToken, err := r.fetch(ctx, pageToken, pageSize)
+		if err != nil {
+			return fmt.Errorf("fetching Mig page: %w", err)
+		}
+
+		for _, mig := range migs {
+			r.cache.RegisterMig(mig)
+		}
+
+		pagesProcessed++
+		migsProcessed += len(migs)
+		pageToken = nextPageToken
+		done := pageToken == ""
+
+		if done {
+			r.cache.bumpGeneration()
+		}
+
+		if r.progress != nil {
+			r.progress.OnRefreshProgress(RefreshProgress{
+				PagesProcessed: pagesProcessed,
+				MigsProcessed:  migsProcessed,
+				Generation:     generation,
+				Done:           done,
+			})
+		}
+
+		if done {
+			klog.V(2).Infof("Refreshed %d Migs across %d pages at generation %d", migsProcessed, pagesProcessed, generation)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// recordingProgressHandler records every RefreshProgress it's notified with.
+type recordingProgressHandler struct {
+	progress []RefreshProgress
+}
+
+func (h *recordingProgressHandler) OnRefreshProgress(progress RefreshProgress) {
+	h.progress = append(h.progress, progress)
+}
+
+// pagedFetcher returns pages one at a time, erroring once it's served
+// errAfterPages pages if errAfterPages >= 0.
+type pagedFetcher struct {
+	pages         [][]Mig
+	errAfterPages int
+	served        int
+}
+
+func (f *pagedFetcher) fetch(ctx context.Context, pageToken string, pageSize int) ([]Mig, string, error) {
+	if f.errAfterPages >= 0 && f.served == f.errAfterPages {
+		return nil, "", errors.New("injected fetch error")
+	}
+	index := f.served
+	f.served++
+	nextPageToken := ""
+	if index < len(f.pages)-1 {
+		nextPageToken = "more"
+	}
+	return f.pages[index], nextPageToken, nil
+}
+
+func TestRefreshMigsBumpsGenerationOnlyOnCompletedPass(t *testing.T) {
+	cache := NewGceCache()
+	fetcher := &pagedFetcher{pages: [][]Mig{{}, {}}, errAfterPages: -1}
+	progress := &recordingProgressHandler{}
+	r := NewRefresher(cache, fetcher.fetch, progress)
+
+	if err := r.RefreshMigs(context.Background(), 10, rate.Inf); err != nil {
+		t.Fatalf("RefreshMigs: %v", err)
+	}
+
+	if got := cache.Generation(); got != 1 {
+		t.Fatalf("Generation() after a completed pass = %d, want 1", got)
+	}
+	if len(progress.progress) != 2 {
+		t.Fatalf("got %d progress reports, want 2 (one per page)", len(progress.progress))
+	}
+	last := progress.progress[len(progress.progress)-1]
+	if !last.Done || last.Generation != 1 {
+		t.Errorf("final progress report = %+v, want Done=true, Generation=1", last)
+	}
+}
+
+func TestRefreshMigsDoesNotBumpGenerationOnFetchError(t *testing.T) {
+	cache := NewGceCache()
+	fetcher := &pagedFetcher{pages: [][]Mig{{}}, errAfterPages: 0}
+	r := NewRefresher(cache, fetcher.fetch, nil)
+
+	if err := r.RefreshMigs(context.Background(), 10, rate.Inf); err == nil {
+		t.Fatal("RefreshMigs succeeded despite the fetcher erroring on the first page")
+	}
+	if got := cache.Generation(); got != 0 {
+		t.Errorf("Generation() after a failed first page = %d, want 0", got)
+	}
+}
+
+func TestRefreshMigsDoesNotBumpGenerationOnFetchErrorPartway(t *testing.T) {
+	cache := NewGceCache()
+	// Two real pages followed by an error before the pass can finish.
+	fetcher := &pagedFetcher{pages: [][]Mig{{}, {}, {}}, errAfterPages: 2}
+	r := NewRefresher(cache, fetcher.fetch, nil)
+
+	if err := r.RefreshMigs(context.Background(), 10, rate.Inf); err == nil {
+		t.Fatal("RefreshMigs succeeded despite the fetcher erroring partway through the pass")
+	}
+	if got := cache.Generation(); got != 0 {
+		t.Errorf("Generation() after a pass that failed partway through = %d, want 0 (a partial pass must not advance it)", got)
+	}
+}
+
+func TestGetMigTargetSizeAtLeastRequiresGeneration(t *testing.T) {
+	cache := NewGceCache()
+	ref := GceRef{Project: "p", Zone: "us-central1-a", Name: "mig"}
+
+	cache.migTargetSizeCache.AddGen(ref, 5, 2)
+
+	if _, ok := cache.GetMigTargetSizeAtLeast(ref, 3); ok {
+		t.Errorf("GetMigTargetSizeAtLeast(ref, 3) succeeded for an entry written at generation 2")
+	}
+	if size, ok := cache.GetMigTargetSizeAtLeast(ref, 2); !ok || size != 5 {
+		t.Errorf("GetMigTargetSizeAtLeast(ref, 2) = %v, %v, want 5, true", size, ok)
+	}
+	if size, ok := cache.GetMigTargetSizeAtLeast(ref, 0); !ok || size != 5 {
+		t.Errorf("GetMigTargetSizeAtLeast(ref, 0) = %v, %v, want 5, true", size, ok)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// defaultShardCount is the number of shards GceCache splits each of its
+// resource maps/caches into, so that concurrent access to keys that land in
+// different shards never contends on the same lock. In clusters with
+// hundreds of MIGs, the main refresh loop (writing target sizes) and node
+// registration (reading instance-to-MIG mappings) would otherwise serialize
+// through a single mutex; 32 shards keeps that contention low without
+// making per-shard bookkeeping overhead noticeable.
+const defaultShardCount = 32
+
+// fnvOffset64 and fnvPrime64 are the FNV-1a constants, inlined here so
+// shardIndex can hash a key's fields directly without allocating a
+// hash.Hash64 per call.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// fnv1a folds s into the running hash h using FNV-1a.
+func fnv1a(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// shardIndex hashes key into one of n shards (n > 0). GceRef and
+// MachineTypeKey - the only two key types GceCache shards on - are
+// special-cased to hash their string fields directly; this keeps shardIndex
+// off the reflection path (fmt's %v) and off a per-call hash.Hash64
+// allocation, since it runs on every cache read and write. Any other
+// comparable key type falls back to the slower, allocating generic path.
+func shardIndex[K comparable](key K, n int) int {
+	h := uint64(fnvOffset64)
+	switch k := any(key).(type) {
+	case GceRef:
+		h = fnv1a(h, k.Project)
+		h = fnv1a(h, k.Zone)
+		h = fnv1a(h, k.Name)
+	case MachineTypeKey:
+		h = fnv1a(h, k.Zone)
+		h = fnv1a(h, k.MachineType)
+	default:
+		hh := fnv.New64a()
+		fmt.Fprintf(hh, "%v", key)
+		h = hh.Sum64()
+	}
+	return int(h % uint64(n))
+}
+
+// mapShard is a single shard of a shardedMap: a plain map guarded by its own
+// RWMutex.
+type mapShard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+}
+
+// shardedMap is an n-way sharded map[K]V. Each shard has its own RWMutex, so
+// reads and writes to keys that hash to different shards never block each
+// other; only keys colliding on the same shard serialize.
+type shardedMap[K comparable, V any] struct {
+	shards []*mapShard[K, V]
+}
+
+func newShardedMap[K comparable, V any](shardCount int) *shardedMap[K, V] {
+	shards := make([]*mapShard[K, V], shardCount)
+	for i := range shards {
+		shards[i] = &mapShard[K, V]{m: map[K]V{}}
+	}
+	return &shardedMap[K, V]{shards: shards}
+}
+
+func (s *shardedMap[K, V]) shardFor(key K) *mapShard[K, V] {
+	return s.shards[shardIndex(key, len(s.shards))]
+}
+
+// Get returns the value stored for key, taking only a read lock on key's shard.
+func (s *shardedMap[K, V]) Get(key K) (V, bool) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	v, ok := sh.m[key]
+	return v, ok
+}
+
+// Set stores value for key.
+func (s *shardedMap[K, V]) Set(key K, value V) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.m[key] = value
+}
+
+// Delete removes key, if present.
+func (s *shardedMap[K, V]) Delete(key K) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	delete(sh.m, key)
+}
+
+// DeleteIfPresent removes key and reports whether it was present, atomically
+// with respect to other operations on the same shard.
+func (s *shardedMap[K, V]) DeleteIfPresent(key K) bool {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	_, found := sh.m[key]
+	if found {
+		delete(sh.m, key)
+	}
+	return found
+}
+
+// Update atomically computes the value to store for key: fn receives the
+// current value (the zero value if absent) and whether it was present, and
+// returns the value to store and whether the map should be updated. Update
+// reports whatever fn returned as changed.
+func (s *shardedMap[K, V]) Update(key K, fn func(old V, found bool) (newValue V, changed bool)) bool {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	old, found := sh.m[key]
+	newValue, changed := fn(old, found)
+	if changed {
+		sh.m[key] = newValue
+	}
+	return changed
+}
+
+// Items returns a snapshot copy of every key/value pair, gathering shards in
+// parallel.
+func (s *shardedMap[K, V]) Items() map[K]V {
+	partials := make([]map[K]V, len(s.shards))
+	var wg sync.WaitGroup
+	for i, sh := range s.shards {
+		i, sh := i, sh
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sh.mu.RLock()
+			defer sh.mu.RUnlock()
+			m := make(map[K]V, len(sh.m))
+			for k, v := range sh.m {
+				m[k] = v
+			}
+			partials[i] = m
+		}()
+	}
+	wg.Wait()
+
+	out := make(map[K]V)
+	for _, p := range partials {
+		for k, v := range p {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Clear empties every shard, in parallel.
+func (s *shardedMap[K, V]) Clear() {
+	var wg sync.WaitGroup
+	for _, sh := range s.shards {
+		sh := sh
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sh.mu.Lock()
+			sh.m = map[K]V{}
+			sh.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// Len returns the total number of entries across all shards.
+func (s *shardedMap[K, V]) Len() int {
+	total := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		total += len(sh.m)
+		sh.mu.RUnlock()
+	}
+	return total
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"time"
+
+	gce "google.golang.org/api/compute/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// Snapshot is a serializable point-in-time copy of the parts of GceCache
+// that are cheap to persist and worth restoring on startup to accelerate
+// cold start: target sizes, basenames, instance template names and bodies,
+// and machine types. Live Mig objects and the instance-to-MIG associations
+// are intentionally excluded: they're rebuilt from a single GCE list call
+// right after startup, so persisting them would only add staleness risk
+// without saving meaningful work.
+type Snapshot struct {
+	// GeneratedAt is when this Snapshot was produced, independent of the
+	// StoredAt timestamp carried by each individual entry.
+	GeneratedAt time.Time
+
+	MigTargetSizes         []SnapshotEntry[GceRef, int64]
+	RegionalMigTargetSizes []SnapshotEntry[GceRef, int64]
+	MigBasenames           []SnapshotEntry[GceRef, string]
+	InstanceTemplateNames  []SnapshotEntry[GceRef, string]
+	InstanceTemplates      []SnapshotEntry[GceRef, *gce.InstanceTemplate]
+	MachineTypes           []SnapshotEntry[MachineTypeKey, *gce.MachineType]
+}
+
+// CacheStore persists and restores GceCache Snapshots, letting a freshly
+// started cluster-autoscaler process skip the cold-start period of empty
+// caches, and the resulting burst of GCE API calls, by hydrating from the
+// last known values instead.
+type CacheStore interface {
+	// Load returns the most recently saved Snapshot, or a zero Snapshot if
+	// none has been saved yet.
+	Load(ctx context.Context) (Snapshot, error)
+	// Save persists snapshot, replacing whatever was previously stored.
+	Save(ctx context.Context, snapshot Snapshot) error
+}
+
+// noopCacheStore is the default CacheStore: it doesn't persist anything, so
+// a GceCache behaves exactly as it did before CacheStore existed.
+type noopCacheStore struct{}
+
+func (noopCacheStore) Load(ctx context.Context) (Snapshot, error) { return Snapshot{}, nil }
+
+func (noopCacheStore) Save(ctx context.Context, snapshot Snapshot) error { return nil }
+
+// LoadFromStore hydrates the cache from the configured CacheStore, marking
+// every restored entry unverified (see UnverifiedEntries) until it's
+// confirmed by a live GCE API call through the normal SetX path. Intended to
+// be called once, right after construction, before the cache starts serving
+// real traffic.
+func (gc *GceCache) LoadFromStore(ctx context.Context) error {
+	snapshot, err := gc.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	gc.migTargetSizeCache.LoadSnapshot(snapshot.MigTargetSizes)
+	gc.regionalMigTargetSizeCache.LoadSnapshot(snapshot.RegionalMigTargetSizes)
+	gc.migBaseNameCache.LoadSnapshot(snapshot.MigBasenames)
+	gc.instanceTemplateNameCache.LoadSnapshot(snapshot.InstanceTemplateNames)
+	gc.instanceTemplatesCache.LoadSnapshot(snapshot.InstanceTemplates)
+	loadMachineTypesSnapshot(gc.machinesCache, snapshot.MachineTypes)
+	return nil
+}
+
+// Snapshot returns a serializable copy of the cache's current state,
+// suitable for passing to a CacheStore's Save.
+func (gc *GceCache) Snapshot() Snapshot {
+	return Snapshot{
+		GeneratedAt:            time.Now(),
+		MigTargetSizes:         gc.migTargetSizeCache.Snapshot(),
+		RegionalMigTargetSizes: gc.regionalMigTargetSizeCache.Snapshot(),
+		MigBasenames:           gc.migBaseNameCache.Snapshot(),
+		InstanceTemplateNames:  gc.instanceTemplateNameCache.Snapshot(),
+		InstanceTemplates:      gc.instanceTemplatesCache.Snapshot(),
+		MachineTypes:           machineTypesSnapshot(gc.machinesCache),
+	}
+}
+
+// machineTypesSnapshot adapts machinesCache's entries to SnapshotEntry[..,
+// *gce.MachineType]: machinesCacheValue also carries an error from a failed
+// GCE lookup, which isn't worth persisting, so entries that cached an error
+// rather than a machine type are skipped.
+func machineTypesSnapshot(c *shardedTTLLruCache[MachineTypeKey, machinesCacheValue]) []SnapshotEntry[MachineTypeKey, *gce.MachineType] {
+	raw := c.Snapshot()
+	out := make([]SnapshotEntry[MachineTypeKey, *gce.MachineType], 0, len(raw))
+	for _, entry := range raw {
+		if entry.Value.err != nil {
+			continue
+		}
+		out = append(out, SnapshotEntry[MachineTypeKey, *gce.MachineType]{
+			Key:        entry.Key,
+			Value:      entry.Value.machineType,
+			Version:    entry.Version,
+			StoredAt:   entry.StoredAt,
+			Verified:   entry.Verified,
+			Generation: entry.Generation,
+		})
+	}
+	return out
+}
+
+// loadMachineTypesSnapshot is the inverse of machineTypesSnapshot, used to
+// hydrate machinesCache from a Snapshot.
+func loadMachineTypesSnapshot(c *shardedTTLLruCache[MachineTypeKey, machinesCacheValue], entries []SnapshotEntry[MachineTypeKey, *gce.MachineType]) {
+	converted := make([]SnapshotEntry[MachineTypeKey, machinesCacheValue], 0, len(entries))
+	for _, entry := range entries {
+		converted = append(converted, SnapshotEntry[MachineTypeKey, machinesCacheValue]{
+			Key:        entry.Key,
+			Value:      machinesCacheValue{machineType: entry.Value},
+			Version:    entry.Version,
+			StoredAt:   entry.StoredAt,
+			Verified:   entry.Verified,
+			Generation: entry.Generation,
+		})
+	}
+	c.LoadSnapshot(converted)
+}
+
+// SaveToStore persists the cache's current state through the configured CacheStore.
+func (gc *GceCache) SaveToStore(ctx context.Context) error {
+	return gc.store.Save(ctx, gc.Snapshot())
+}
+
+// RunPeriodicSnapshots saves the cache's state through the configured
+// CacheStore every interval, until ctx is cancelled or the returned stop
+// function is called. A failed Save is logged and otherwise ignored, so a
+// transient store outage doesn't affect normal cache operation.
+func (gc *GceCache) RunPeriodicSnapshots(ctx context.Context, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := gc.SaveToStore(ctx); err != nil {
+					klog.Warningf("Failed to save GceCache snapshot: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// UnverifiedEntries returns the number of cache entries, across every
+// persisted sub-cache, that were restored from a CacheStore snapshot but
+// haven't yet been confirmed by a live GCE API call. Useful for monitoring
+// how much of a freshly hydrated cache is still "unverified" after startup.
+func (gc *GceCache) UnverifiedEntries() int {
+	return gc.migTargetSizeCache.UnverifiedCount() +
+		gc.regionalMigTargetSizeCache.UnverifiedCount() +
+		gc.migBaseNameCache.UnverifiedCount() +
+		gc.instanceTemplateNameCache.UnverifiedCount() +
+		gc.instanceTemplatesCache.UnverifiedCount() +
+		gc.machinesCache.UnverifiedCount()
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	gce "google.golang.org/api/compute/v1"
+)
+
+func TestTTLLruCacheLoadSnapshotMarksUnverifiedAndResetsGeneration(t *testing.T) {
+	c := newTTLLruCache[string, int]("test", 10, 0)
+	c.LoadSnapshot([]SnapshotEntry[string, int]{
+		{Key: "a", Value: 1, Version: "100", StoredAt: time.Now(), Verified: true, Generation: 7},
+	})
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) after LoadSnapshot = %v, %v, want 1, true", v, ok)
+	}
+	if got := c.UnverifiedCount(); got != 1 {
+		t.Fatalf("UnverifiedCount() = %d, want 1 (restored entries start unverified)", got)
+	}
+	if _, ok := c.GetAtLeast("a", 1); ok {
+		t.Errorf("GetAtLeast(a, 1) succeeded for an unverified, generation-reset entry")
+	}
+	if _, ok := c.GetAtLeast("a", 0); ok {
+		t.Errorf("GetAtLeast(a, 0) succeeded for an unverified entry, want it to require verification regardless of minGen")
+	}
+
+	c.Add("a", 2) // a live write confirms the entry
+	if got := c.UnverifiedCount(); got != 0 {
+		t.Errorf("UnverifiedCount() = %d after a live Add, want 0", got)
+	}
+	if v, ok := c.GetAtLeast("a", 0); !ok || v != 2 {
+		t.Errorf("GetAtLeast(a, 0) after a confirming Add = %v, %v, want 2, true", v, ok)
+	}
+}
+
+func TestTTLLruCacheLoadSnapshotSkipsStaleVersion(t *testing.T) {
+	c := newTTLLruCache[string, int]("test", 10, 0)
+	c.Add("a", 1) // Add stamps a version derived from the current time
+
+	liveVersion := func() string {
+		for _, e := range c.Snapshot() {
+			if e.Key == "a" {
+				return e.Version
+			}
+		}
+		t.Fatalf("key a missing from Snapshot right after Add")
+		return ""
+	}()
+
+	staleVersion := "0" + liveVersion[1:] // same digit-length, lexicographically smaller
+	c.LoadSnapshot([]SnapshotEntry[string, int]{
+		{Key: "a", Value: 99, Version: staleVersion, StoredAt: time.Now()},
+	})
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v, want the live value 1 unchanged: LoadSnapshot must not regress a newer live entry with a stale snapshot one", v, ok)
+	}
+	if got := c.UnverifiedCount(); got != 0 {
+		t.Errorf("UnverifiedCount() = %d, want 0: the live entry was never replaced, so it must not be marked unverified", got)
+	}
+}
+
+// fakeCacheStore is an in-memory CacheStore for tests, standing in for a real
+// persistent one (e.g. a file or object store implementation).
+type fakeCacheStore struct {
+	mu       sync.Mutex
+	snapshot Snapshot
+}
+
+func (s *fakeCacheStore) Load(ctx context.Context) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot, nil
+}
+
+func (s *fakeCacheStore) Save(ctx context.Context, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+	return nil
+}
+
+func TestGceCacheSaveAndLoadFromStoreRoundTrip(t *testing.T) {
+	store := &fakeCacheStore{}
+	cfg := DefaultGceCacheConfig()
+	cfg.Store = store
+
+	source := NewGceCacheWithConfig(cfg)
+	migRef := GceRef{Project: "p", Zone: "us-central1-a", Name: "mig"}
+	source.SetMigTargetSize(migRef, 5)
+	source.SetMigInstanceTemplate(migRef, &gce.InstanceTemplate{Name: "tmpl"})
+
+	if err := source.SaveToStore(context.Background()); err != nil {
+		t.Fatalf("SaveToStore: %v", err)
+	}
+
+	restored := NewGceCacheWithConfig(cfg)
+	if err := restored.LoadFromStore(context.Background()); err != nil {
+		t.Fatalf("LoadFromStore: %v", err)
+	}
+
+	if size, ok := restored.GetMigTargetSize(migRef); !ok || size != 5 {
+		t.Errorf("GetMigTargetSize(migRef) after restore = %v, %v, want 5, true", size, ok)
+	}
+	template, ok := restored.GetMigInstanceTemplate(migRef)
+	if !ok || template == nil || template.Name != "tmpl" {
+		t.Errorf("GetMigInstanceTemplate(migRef) after restore = %v, %v, want a template named %q", template, ok, "tmpl")
+	}
+
+	// The two entries above were hydrated from the store, not confirmed by a
+	// live call in this process, so they must count as unverified.
+	if got := restored.UnverifiedEntries(); got != 2 {
+		t.Errorf("UnverifiedEntries() after restore = %d, want 2", got)
+	}
+
+	// Confirming one of them via a live call clears its unverified status.
+	restored.SetMigTargetSize(migRef, 6)
+	if got := restored.UnverifiedEntries(); got != 1 {
+		t.Errorf("UnverifiedEntries() after a confirming SetMigTargetSize = %d, want 1", got)
+	}
+}
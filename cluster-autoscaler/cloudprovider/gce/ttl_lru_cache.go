@@ -0,0 +1,479 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// cacheMetrics holds hit/miss/eviction/expiration counters for a single
+// named sub-cache of GceCache. All fields are updated atomically so they
+// can be read concurrently with cache operations.
+type cacheMetrics struct {
+	name        string
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// CacheMetricsSnapshot is a point-in-time copy of a sub-cache's counters,
+// returned to callers so they don't hold a reference to the live counters.
+type CacheMetricsSnapshot struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+}
+
+func (m *cacheMetrics) snapshot() CacheMetricsSnapshot {
+	return CacheMetricsSnapshot{
+		Hits:        m.hits.Load(),
+		Misses:      m.misses.Load(),
+		Evictions:   m.evictions.Load(),
+		Expirations: m.expirations.Load(),
+	}
+}
+
+type ttlLruEntry[V any] struct {
+	value    V
+	storedAt time.Time
+	// version is an opaque, monotonically-increasing-in-practice token set
+	// whenever the entry is written by Add. It's carried through
+	// Snapshot/LoadSnapshot so a CacheStore can reason about staleness
+	// across process restarts without needing to understand V.
+	version string
+	// verified is false for entries hydrated from a CacheStore snapshot
+	// that haven't yet been confirmed by a live Add from the GCE API, and
+	// true otherwise. Unverified entries are still served normally by Get;
+	// the flag affects UnverifiedCount, and GetAtLeast, which treats an
+	// unverified entry as a miss.
+	verified bool
+	// generation is the GceCache-wide generation counter (see
+	// generation.go) at the time this entry was written by AddGen. It's
+	// left at zero for entries written through the plain Add, which makes
+	// them visible to any GetAtLeast(key, 0) call but not to one asking
+	// for a specific, later generation.
+	generation int64
+}
+
+// SnapshotEntry is the serializable form of a single ttlLruCache entry,
+// suitable for persisting through a CacheStore and restoring on a later
+// process start.
+type SnapshotEntry[K comparable, V any] struct {
+	Key        K
+	Value      V
+	Version    string
+	StoredAt   time.Time
+	Verified   bool
+	Generation int64
+}
+
+// ttlLruCache is a fixed-capacity LRU cache with a per-entry TTL on top of
+// hashicorp/golang-lru. Capacity overflow is handled by the underlying LRU
+// (oldest entry evicted); staleness is handled on read, where an entry older
+// than ttl is treated and reported as a miss and dropped from the cache.
+//
+// A zero ttl disables expiry (entries only ever leave via LRU eviction or
+// explicit removal), which is useful for resources that don't go stale on
+// their own, only grow stale by being superseded.
+type ttlLruCache[K comparable, V any] struct {
+	ttl     time.Duration
+	now     func() time.Time
+	lru     *lru.Cache[K, ttlLruEntry[V]]
+	metrics cacheMetrics
+}
+
+// newTTLLruCache creates a ttlLruCache with the given name (used only for
+// metrics/log attribution), capacity and TTL. size must be positive.
+func newTTLLruCache[K comparable, V any](name string, size int, ttl time.Duration) *ttlLruCache[K, V] {
+	c, err := lru.New[K, ttlLruEntry[V]](size)
+	if err != nil {
+		// Only happens for size <= 0, which is a programming error by the caller.
+		panic(fmt.Sprintf("gce cache %q: invalid LRU size %d: %v", name, size, err))
+	}
+	return &ttlLruCache[K, V]{
+		ttl:     ttl,
+		now:     time.Now,
+		lru:     c,
+		metrics: cacheMetrics{name: name},
+	}
+}
+
+// Get returns the cached value for key, treating an expired entry as a miss
+// and evicting it.
+func (c *ttlLruCache[K, V]) Get(key K) (V, bool) {
+	entry, ok := c.lru.Get(key)
+	if !ok {
+		c.metrics.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	if c.ttl > 0 && c.now().Sub(entry.storedAt) > c.ttl {
+		c.lru.Remove(key)
+		c.metrics.expirations.Add(1)
+		c.metrics.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.metrics.hits.Add(1)
+	return entry.value, true
+}
+
+// Contains reports whether key has a live, non-expired entry, without
+// affecting LRU recency order or hit/miss/expiration metrics. Intended for
+// existence checks that aren't really a cache access, e.g. deciding whether
+// an Invalidate call has anything to invalidate.
+func (c *ttlLruCache[K, V]) Contains(key K) bool {
+	entry, ok := c.lru.Peek(key)
+	if !ok {
+		return false
+	}
+	return c.ttl <= 0 || c.now().Sub(entry.storedAt) <= c.ttl
+}
+
+// Add sets value for key, refreshing its timestamp and version and marking
+// it verified, and evicts the oldest entry if the cache is at capacity.
+func (c *ttlLruCache[K, V]) Add(key K, value V) {
+	c.AddGen(key, value, 0)
+}
+
+// AddGen behaves like Add, additionally stamping the entry with gen so it
+// can later be looked up with GetAtLeast.
+func (c *ttlLruCache[K, V]) AddGen(key K, value V, gen int64) {
+	now := c.now()
+	evicted := c.lru.Add(key, ttlLruEntry[V]{
+		value:      value,
+		storedAt:   now,
+		version:    fmt.Sprintf("%d", now.UnixNano()),
+		verified:   true,
+		generation: gen,
+	})
+	if evicted {
+		c.metrics.evictions.Add(1)
+	}
+}
+
+// GetAtLeast behaves like Get, but additionally treats an entry as a miss
+// if it was written at a generation older than minGen, or if it's
+// unverified: an entry restored from a CacheStore snapshot (see
+// LoadSnapshot) carries whatever generation the previous process had
+// reached, which says nothing about freshness in this process, so it can
+// only satisfy a freshness query once a live Add/AddGen has confirmed it.
+func (c *ttlLruCache[K, V]) GetAtLeast(key K, minGen int64) (V, bool) {
+	entry, ok := c.lru.Get(key)
+	if !ok {
+		c.metrics.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	if c.ttl > 0 && c.now().Sub(entry.storedAt) > c.ttl {
+		c.lru.Remove(key)
+		c.metrics.expirations.Add(1)
+		c.metrics.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	if !entry.verified || entry.generation < minGen {
+		c.metrics.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.metrics.hits.Add(1)
+	return entry.value, true
+}
+
+// Remove removes key from the cache, if present.
+func (c *ttlLruCache[K, V]) Remove(key K) {
+	c.lru.Remove(key)
+}
+
+// Purge removes all entries from the cache.
+func (c *ttlLruCache[K, V]) Purge() {
+	c.lru.Purge()
+}
+
+// Len returns the number of entries currently stored, including any that
+// have expired but haven't been evicted by a read yet.
+func (c *ttlLruCache[K, V]) Len() int {
+	return c.lru.Len()
+}
+
+// Keys returns the keys currently stored, in no particular order, including
+// any that have expired but haven't been evicted by a read yet.
+func (c *ttlLruCache[K, V]) Keys() []K {
+	return c.lru.Keys()
+}
+
+// Metrics returns a snapshot of this sub-cache's hit/miss/eviction/expiration counters.
+func (c *ttlLruCache[K, V]) Metrics() CacheMetricsSnapshot {
+	return c.metrics.snapshot()
+}
+
+// Snapshot returns every non-expired entry as a SnapshotEntry, for
+// persisting through a CacheStore. Uses Peek so that taking a snapshot
+// doesn't perturb LRU recency order.
+func (c *ttlLruCache[K, V]) Snapshot() []SnapshotEntry[K, V] {
+	keys := c.lru.Keys()
+	out := make([]SnapshotEntry[K, V], 0, len(keys))
+	for _, key := range keys {
+		entry, ok := c.lru.Peek(key)
+		if !ok {
+			continue
+		}
+		if c.ttl > 0 && c.now().Sub(entry.storedAt) > c.ttl {
+			continue
+		}
+		out = append(out, SnapshotEntry[K, V]{
+			Key:        key,
+			Value:      entry.value,
+			Version:    entry.version,
+			StoredAt:   entry.storedAt,
+			Verified:   entry.verified,
+			Generation: entry.generation,
+		})
+	}
+	return out
+}
+
+// LoadSnapshot hydrates the cache from entries previously returned by
+// Snapshot, marking each one unverified until it's confirmed by a live Add.
+//
+// The restored generation is always reset to 0, never entry.Generation: a
+// snapshot's Generation is whatever the previous process's counter had
+// reached, and this process's counter restarts at 0, so keeping the old
+// value would let a stale, never-reconfirmed entry satisfy a
+// GetAtLeast(key, 1) after the very first refresh pass of this process.
+// GetAtLeast also separately requires verified, which is belt-and-suspenders
+// for the same reason.
+//
+// An entry already present with an equal or newer Version is left alone:
+// Version is an opaque, increasing-over-time token (see Add), so this
+// discards stale snapshot entries in favor of whatever a live Add already
+// wrote, rather than regressing a good cache entry on startup.
+func (c *ttlLruCache[K, V]) LoadSnapshot(entries []SnapshotEntry[K, V]) {
+	for _, entry := range entries {
+		if existing, ok := c.lru.Peek(entry.Key); ok && existing.version >= entry.Version {
+			continue
+		}
+		evicted := c.lru.Add(entry.Key, ttlLruEntry[V]{
+			value:      entry.Value,
+			storedAt:   entry.StoredAt,
+			version:    entry.Version,
+			verified:   false,
+			generation: 0,
+		})
+		if evicted {
+			c.metrics.evictions.Add(1)
+		}
+	}
+}
+
+// UnverifiedCount returns the number of entries still marked unverified,
+// i.e. restored from a CacheStore snapshot but not yet confirmed by a live
+// GCE API call.
+func (c *ttlLruCache[K, V]) UnverifiedCount() int {
+	count := 0
+	for _, key := range c.lru.Keys() {
+		if entry, ok := c.lru.Peek(key); ok && !entry.verified {
+			count++
+		}
+	}
+	return count
+}
+
+// shardedTTLLruCache splits a ttlLruCache into shardCount independently
+// locked shards, keyed by shardIndex(key, shardCount), so that a write for
+// one key can't block a read for an unrelated key. Each shard gets an equal
+// slice of the configured total capacity.
+type shardedTTLLruCache[K comparable, V any] struct {
+	shards []*ttlLruCache[K, V]
+}
+
+func newShardedTTLLruCache[K comparable, V any](name string, shardCount, totalSize int, ttl time.Duration) *shardedTTLLruCache[K, V] {
+	perShard := (totalSize + shardCount - 1) / shardCount
+	if perShard < 1 {
+		perShard = 1
+	}
+	shards := make([]*ttlLruCache[K, V], shardCount)
+	for i := range shards {
+		shards[i] = newTTLLruCache[K, V](fmt.Sprintf("%s[%d]", name, i), perShard, ttl)
+	}
+	return &shardedTTLLruCache[K, V]{shards: shards}
+}
+
+func (s *shardedTTLLruCache[K, V]) shardFor(key K) *ttlLruCache[K, V] {
+	return s.shards[shardIndex(key, len(s.shards))]
+}
+
+// Get returns the cached value for key, touching only key's shard.
+func (s *shardedTTLLruCache[K, V]) Get(key K) (V, bool) {
+	return s.shardFor(key).Get(key)
+}
+
+// Contains reports whether key has a live, non-expired entry, without
+// affecting LRU recency order or hit/miss/expiration metrics.
+func (s *shardedTTLLruCache[K, V]) Contains(key K) bool {
+	return s.shardFor(key).Contains(key)
+}
+
+// Add sets value for key, touching only key's shard.
+func (s *shardedTTLLruCache[K, V]) Add(key K, value V) {
+	s.shardFor(key).Add(key, value)
+}
+
+// AddGen sets value for key stamped with generation gen, touching only key's shard.
+func (s *shardedTTLLruCache[K, V]) AddGen(key K, value V, gen int64) {
+	s.shardFor(key).AddGen(key, value, gen)
+}
+
+// GetAtLeast returns the cached value for key, touching only key's shard,
+// treating an entry written before generation minGen as a miss.
+func (s *shardedTTLLruCache[K, V]) GetAtLeast(key K, minGen int64) (V, bool) {
+	return s.shardFor(key).GetAtLeast(key, minGen)
+}
+
+// AddBatch inserts entries, fanning the writes out across shards in
+// parallel: entries are grouped by destination shard first, then each
+// shard's batch is applied by its own goroutine.
+func (s *shardedTTLLruCache[K, V]) AddBatch(entries map[K]V) {
+	buckets := make([]map[K]V, len(s.shards))
+	for k, v := range entries {
+		idx := shardIndex(k, len(s.shards))
+		if buckets[idx] == nil {
+			buckets[idx] = make(map[K]V)
+		}
+		buckets[idx][k] = v
+	}
+
+	var wg sync.WaitGroup
+	for i, bucket := range buckets {
+		if len(bucket) == 0 {
+			continue
+		}
+		i, bucket := i, bucket
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k, v := range bucket {
+				s.shards[i].Add(k, v)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Remove removes key from its shard, if present.
+func (s *shardedTTLLruCache[K, V]) Remove(key K) {
+	s.shardFor(key).Remove(key)
+}
+
+// Purge empties every shard, in parallel.
+func (s *shardedTTLLruCache[K, V]) Purge() {
+	var wg sync.WaitGroup
+	for _, sh := range s.shards {
+		sh := sh
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sh.Purge()
+		}()
+	}
+	wg.Wait()
+}
+
+// Keys returns the keys currently stored across every shard, in no particular order.
+func (s *shardedTTLLruCache[K, V]) Keys() []K {
+	var all []K
+	for _, sh := range s.shards {
+		all = append(all, sh.Keys()...)
+	}
+	return all
+}
+
+// Metrics returns the sum of hit/miss/eviction/expiration counters across every shard.
+func (s *shardedTTLLruCache[K, V]) Metrics() CacheMetricsSnapshot {
+	var agg CacheMetricsSnapshot
+	for _, sh := range s.shards {
+		m := sh.Metrics()
+		agg.Hits += m.Hits
+		agg.Misses += m.Misses
+		agg.Evictions += m.Evictions
+		agg.Expirations += m.Expirations
+	}
+	return agg
+}
+
+// Snapshot returns every non-expired entry across every shard, gathered in parallel.
+func (s *shardedTTLLruCache[K, V]) Snapshot() []SnapshotEntry[K, V] {
+	partials := make([][]SnapshotEntry[K, V], len(s.shards))
+	var wg sync.WaitGroup
+	for i, sh := range s.shards {
+		i, sh := i, sh
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			partials[i] = sh.Snapshot()
+		}()
+	}
+	wg.Wait()
+
+	var all []SnapshotEntry[K, V]
+	for _, p := range partials {
+		all = append(all, p...)
+	}
+	return all
+}
+
+// LoadSnapshot hydrates every shard from entries previously returned by
+// Snapshot, fanning the writes out across shards in parallel.
+func (s *shardedTTLLruCache[K, V]) LoadSnapshot(entries []SnapshotEntry[K, V]) {
+	buckets := make([][]SnapshotEntry[K, V], len(s.shards))
+	for _, entry := range entries {
+		idx := shardIndex(entry.Key, len(s.shards))
+		buckets[idx] = append(buckets[idx], entry)
+	}
+
+	var wg sync.WaitGroup
+	for i, bucket := range buckets {
+		if len(bucket) == 0 {
+			continue
+		}
+		i, bucket := i, bucket
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.shards[i].LoadSnapshot(bucket)
+		}()
+	}
+	wg.Wait()
+}
+
+// UnverifiedCount returns the number of entries, across every shard, still
+// marked unverified.
+func (s *shardedTTLLruCache[K, V]) UnverifiedCount() int {
+	total := 0
+	for _, sh := range s.shards {
+		total += sh.UnverifiedCount()
+	}
+	return total
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLLruCacheExpiry(t *testing.T) {
+	c := newTTLLruCache[string, int]("test", 10, 50*time.Millisecond)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v, want 1, true", v, ok)
+	}
+
+	now = now.Add(100 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("Get(a) after TTL elapsed found an entry, want miss")
+	}
+
+	m := c.Metrics()
+	if m.Hits != 1 {
+		t.Errorf("Hits = %d, want 1", m.Hits)
+	}
+	if m.Misses != 1 {
+		t.Errorf("Misses = %d, want 1", m.Misses)
+	}
+	if m.Expirations != 1 {
+		t.Errorf("Expirations = %d, want 1", m.Expirations)
+	}
+}
+
+func TestTTLLruCacheZeroTTLNeverExpires(t *testing.T) {
+	c := newTTLLruCache[string, int]("test", 10, 0)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1)
+	now = now.Add(24 * time.Hour)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) with TTL disabled = %v, %v, want 1, true even after a long time", v, ok)
+	}
+}
+
+func TestTTLLruCacheEviction(t *testing.T) {
+	c := newTTLLruCache[string, int]("test", 2, 0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3) // over capacity, evicts the least recently used entry ("a")
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get(a) found an entry after it should have been evicted")
+	}
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Errorf("Get(b) = %v, %v, want 2, true", v, ok)
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %v, %v, want 3, true", v, ok)
+	}
+	if got := c.Metrics().Evictions; got != 1 {
+		t.Errorf("Evictions = %d, want 1", got)
+	}
+}
+
+func TestTTLLruCacheContainsDoesNotAffectMetricsOrRecency(t *testing.T) {
+	c := newTTLLruCache[string, int]("test", 2, 50*time.Millisecond)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if c.Contains("a") {
+		t.Fatalf("Contains(a) = true before Add")
+	}
+	c.Add("a", 1)
+	if !c.Contains("a") {
+		t.Fatalf("Contains(a) = false after Add")
+	}
+
+	before := c.Metrics()
+	if before.Hits != 0 || before.Misses != 0 {
+		t.Fatalf("Contains recorded hit/miss metrics: %+v", before)
+	}
+
+	now = now.Add(100 * time.Millisecond)
+	if c.Contains("a") {
+		t.Fatalf("Contains(a) = true after TTL elapsed, want false")
+	}
+	after := c.Metrics()
+	if after != before {
+		t.Errorf("Contains on an expired entry mutated metrics: before %+v, after %+v", before, after)
+	}
+}